@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"realtime-chat/internal/auth"
+	"realtime-chat/internal/broker"
 	"realtime-chat/internal/config"
 	"realtime-chat/internal/db"
 	"realtime-chat/internal/handlers"
 	"realtime-chat/internal/messages"
 	"realtime-chat/internal/presence"
+	"realtime-chat/internal/search"
+	"realtime-chat/internal/translate"
 	"realtime-chat/internal/ws"
 
 	"github.com/go-chi/chi/v5"
@@ -20,10 +26,30 @@ import (
 func main() {
 	config.Load()
 	db.Connect()
-
-	hub := ws.NewHub()
+	db.EnsureIndexes(context.Background())
+
+	b, err := broker.New(config.C.Broker, config.C.RedisURL, config.C.BrokerChannel)
+	if err != nil {
+		log.Fatalf("❌ Broker init failed: %v", err)
+	}
+	defer b.Close()
+
+	tr, err := translate.New(config.C.Translator, config.C.TranslateURL, config.C.TranslateAPIKey, config.C.TranslateTimeout)
+	if err != nil {
+		log.Fatalf("❌ Translator init failed: %v", err)
+	}
+
+	hub := ws.NewHub(b, tr)
+	go hub.RunScheduler(context.Background())
+	go hub.RunExpiry(context.Background())
+	go hub.RunPolls(context.Background())
+	go hub.RunTranslations(context.Background())
+	go hub.RunHeartbeat(context.Background())
 	presAPI := &presence.PresenceAPI{Hub: hub}
-	userHandler := handlers.NewUserHandler(db.Users(), db.Groups(), db.Messages())
+	historyAPI := &messages.HistoryAPI{Hub: hub}
+	scheduledAPI := &messages.ScheduledAPI{Hub: hub}
+	searchAPI := &search.API{Searcher: search.NewMongo()}
+	userHandler := handlers.NewUserHandler(db.Users(), db.Groups(), db.Messages(), db.ReadCursors(), hub)
 
 	r := chi.NewRouter()
 
@@ -87,8 +113,13 @@ func main() {
 		pr.Get("/presence/{userId}", presAPI.GetPresenceOf)
 
 		// history
-		pr.Get("/messages/dm", messages.GetDMHistory)
-		pr.Get("/messages/group", messages.GetGroupHistory)
+		pr.Get("/messages/dm", historyAPI.GetDMHistory)
+		pr.Get("/messages/group", historyAPI.GetGroupHistory)
+		pr.Get("/messages/thread/{id}", messages.GetThread)
+		pr.Get("/messages/search", searchAPI.Search)
+		pr.Get("/me/mentions", messages.GetMentions)
+		pr.Get("/messages/scheduled", scheduledAPI.List)
+		pr.Delete("/messages/scheduled/{id}", scheduledAPI.Cancel)
 
 		// users
 		pr.Get("/users/search", userHandler.SearchUsers)
@@ -97,6 +128,7 @@ func main() {
 		// conversations
 		pr.Get("/conversations", userHandler.GetUserConversations)
 		pr.Delete("/conversations/{id}", userHandler.DeleteConversation)
+		pr.Get("/conversations/{id}/pins", historyAPI.GetPins)
 
 		// file uploads
 		pr.Post("/upload", handlers.UploadFile)
@@ -117,15 +149,46 @@ func main() {
 			return
 		}
 
+		// devices get messages in ?lang=, else the user's profile language
 		lang := r.URL.Query().Get("lang")
+		if lang == "" {
+			lang = messages.ProfileLang(r.Context(), userID)
+		}
 		if lang == "" {
 			lang = "en"
 		}
 
-		log.Printf("🔌 WebSocket connection established for user: %s (lang: %s)", userID, lang)
-		ws.ServeWS(hub, userID, lang, w, r)
+		// optional per-device session id so several devices can stay connected
+		deviceID := r.URL.Query().Get("device_id")
+
+		// optional resume point: last event seq the client has seen
+		since := int64(-1)
+		if s := r.URL.Query().Get("since"); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid since", http.StatusBadRequest)
+				return
+			}
+			since = n
+		}
+
+		log.Printf("🔌 WebSocket connection established for user: %s (lang: %s, device: %s, since: %d)", userID, lang, deviceID, since)
+		ws.ServeWS(hub, userID, deviceID, lang, since, w, r)
 	})
 
+	// Runtime and translation pipeline metrics (expvar) stay off the public
+	// API: they are served on DEBUG_ADDR, loopback only by default
+	if config.C.DebugAddr != "off" {
+		debug := http.NewServeMux()
+		debug.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			log.Println("🔧 Debug metrics on " + config.C.DebugAddr)
+			if err := http.ListenAndServe(config.C.DebugAddr, debug); err != nil {
+				log.Printf("⚠️ debug listener stopped: %v", err)
+			}
+		}()
+	}
+
 	log.Println("🚀 Server on :" + config.C.Port)
 	log.Fatal(http.ListenAndServe(":"+config.C.Port, r))
 }
@@ -41,13 +41,14 @@ func MeHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Return user data in format expected by frontend
 	response := map[string]interface{}{
-		"user_id":      user.ID,
-		"email":        user.Email,
-		"name":         user.Name,
-		"display_name": user.DisplayName,
-		"language":     user.Language,
-		"locale":       user.Locale,
-		"is_verified":  user.IsVerified,
+		"user_id":       user.ID,
+		"email":         user.Email,
+		"name":          user.Name,
+		"display_name":  user.DisplayName,
+		"language":      user.Language,
+		"locale":        user.Locale,
+		"is_verified":   user.IsVerified,
+		"read_receipts": user.SendsReadReceipts(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -67,6 +68,8 @@ func UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
 		Name        string `json:"name,omitempty"`
 		DisplayName string `json:"displayName,omitempty"`
 		Language    string `json:"language,omitempty"`
+		// pointer so that an explicit false can be told apart from "not sent"
+		ReadReceipts *bool `json:"readReceipts,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
@@ -100,6 +103,10 @@ func UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
 		update["$set"].(bson.M)["locale"] = updateData.Language // Sync locale with language
 	}
 
+	if updateData.ReadReceipts != nil {
+		update["$set"].(bson.M)["read_receipts"] = *updateData.ReadReceipts
+	}
+
 	// Always update timestamp
 	now := time.Now()
 	update["$set"].(bson.M)["updated_at"] = &now
@@ -124,13 +131,14 @@ func UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Return updated user data
 	response := map[string]interface{}{
-		"user_id":      user.ID,
-		"email":        user.Email,
-		"name":         user.Name,
-		"display_name": user.DisplayName,
-		"language":     user.Language,
-		"locale":       user.Locale,
-		"is_verified":  user.IsVerified,
+		"user_id":       user.ID,
+		"email":         user.Email,
+		"name":          user.Name,
+		"display_name":  user.DisplayName,
+		"language":      user.Language,
+		"locale":        user.Locale,
+		"is_verified":   user.IsVerified,
+		"read_receipts": user.SendsReadReceipts(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,39 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Envelope is a single hub event travelling between server nodes.
+// Data is kind-specific JSON owned by the publisher (see internal/ws).
+type Envelope struct {
+	Kind   string          `json:"kind"`   // e.g. "deliver" | "presence" | "group"
+	Origin string          `json:"origin"` // node ID of the publisher
+	Data   json.RawMessage `json:"data"`
+}
+
+// Handler is called for every envelope published by any node, including the
+// node that published it.
+type Handler func(Envelope)
+
+// Broker fans hub events out to every server node so that any node can
+// route a message to any connected user.
+type Broker interface {
+	Publish(ctx context.Context, env Envelope) error
+	Subscribe(h Handler) error
+	Close() error
+}
+
+// New builds the broker selected by kind ("local" or "redis").
+func New(kind, redisURL, channel string) (Broker, error) {
+	switch kind {
+	case "", "local":
+		return NewLocal(), nil
+	case "redis":
+		return NewRedis(redisURL, channel)
+	default:
+		return nil, fmt.Errorf("unknown broker %q", kind)
+	}
+}
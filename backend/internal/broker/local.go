@@ -0,0 +1,37 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// Local is an in-process broker for single-node deployments.
+// Publish invokes subscribers synchronously, preserving publish order.
+type Local struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (l *Local) Publish(ctx context.Context, env Envelope) error {
+	l.mu.RLock()
+	handlers := l.handlers
+	l.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(env)
+	}
+	return nil
+}
+
+func (l *Local) Subscribe(h Handler) error {
+	l.mu.Lock()
+	l.handlers = append(l.handlers, h)
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *Local) Close() error { return nil }
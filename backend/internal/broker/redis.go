@@ -0,0 +1,88 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a broker backed by Redis pub/sub. Every node subscribes to the
+// same channel, so an envelope published on one node reaches all of them.
+type Redis struct {
+	client  *redis.Client
+	channel string
+
+	mu     sync.Mutex
+	subs   []*redis.PubSub
+	cancel context.CancelFunc
+	ctx    context.Context
+}
+
+// NewRedis connects to the server at url (e.g. redis://localhost:6379/0).
+func NewRedis(url, channel string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	if channel == "" {
+		channel = "realchat:events"
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis ping: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Redis{client: client, channel: channel, ctx: ctx, cancel: cancel}, nil
+}
+
+func (r *Redis) Publish(ctx context.Context, env Envelope) error {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, b).Err()
+}
+
+// Subscribe blocks until the subscription is confirmed by the server, then
+// dispatches envelopes to h from a background goroutine.
+func (r *Redis) Subscribe(h Handler) error {
+	ps := r.client.Subscribe(r.ctx, r.channel)
+	if _, err := ps.Receive(r.ctx); err != nil {
+		ps.Close()
+		return fmt.Errorf("redis subscribe: %w", err)
+	}
+
+	r.mu.Lock()
+	r.subs = append(r.subs, ps)
+	r.mu.Unlock()
+
+	go func() {
+		for msg := range ps.Channel() {
+			var env Envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("⚠️ broker: dropping malformed envelope: %v", err)
+				continue
+			}
+			h(env)
+		}
+	}()
+	return nil
+}
+
+func (r *Redis) Close() error {
+	r.cancel()
+	r.mu.Lock()
+	for _, ps := range r.subs {
+		ps.Close()
+	}
+	r.subs = nil
+	r.mu.Unlock()
+	return r.client.Close()
+}
@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestRedis connects to the server at REDIS_ADDR (e.g. localhost:6379),
+// skipping the test when it isn't set.
+func newTestRedis(t *testing.T, channel string) *Redis {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	r, err := NewRedis("redis://"+addr+"/0", channel)
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRedisFanOut(t *testing.T) {
+	channel := fmt.Sprintf("realchat:test:%d", time.Now().UnixNano())
+	a := newTestRedis(t, channel)
+	b := newTestRedis(t, channel)
+
+	gotA := make(chan Envelope, 4)
+	gotB := make(chan Envelope, 4)
+	if err := a.Subscribe(func(env Envelope) { gotA <- env }); err != nil {
+		t.Fatalf("subscribe a: %v", err)
+	}
+	if err := b.Subscribe(func(env Envelope) { gotB <- env }); err != nil {
+		t.Fatalf("subscribe b: %v", err)
+	}
+
+	sent := Envelope{Kind: "deliver", Origin: "node-a", Data: json.RawMessage(`{"to":["u1"]}`)}
+	if err := a.Publish(context.Background(), sent); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	// every node, the publisher included, receives the envelope
+	for name, ch := range map[string]chan Envelope{"publisher": gotA, "other node": gotB} {
+		select {
+		case env := <-ch:
+			if env.Kind != sent.Kind || env.Origin != sent.Origin || string(env.Data) != string(sent.Data) {
+				t.Errorf("%s got %+v, want %+v", name, env, sent)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s received nothing", name)
+		}
+	}
+}
+
+func TestRedisPreservesOrder(t *testing.T) {
+	channel := fmt.Sprintf("realchat:test:%d", time.Now().UnixNano())
+	pub := newTestRedis(t, channel)
+	sub := newTestRedis(t, channel)
+
+	got := make(chan Envelope, 100)
+	if err := sub.Subscribe(func(env Envelope) { got <- env }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		env := Envelope{Kind: "deliver", Origin: "n", Data: json.RawMessage(fmt.Sprint(i))}
+		if err := pub.Publish(context.Background(), env); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		select {
+		case env := <-got:
+			if string(env.Data) != fmt.Sprint(i) {
+				t.Fatalf("envelope %d: got data %s", i, env.Data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of 50 envelopes arrived", i)
+		}
+	}
+}
+
+func TestNewRedisBadURL(t *testing.T) {
+	if _, err := NewRedis("not a url", ""); err == nil {
+		t.Fatal("expected an error for a malformed url")
+	}
+}
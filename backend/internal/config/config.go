@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -20,6 +21,21 @@ type AppConfig struct {
 	ClientURL     string
 	BaseURL       string
 	Port          string
+	Broker        string // "local" (single node) or "redis"
+	RedisURL      string
+	BrokerChannel string
+	EditWindow    time.Duration // how long after sending a message may be edited
+	// Translation provider: "fake" (default), "none" or "libretranslate"
+	Translator       string
+	TranslateURL     string
+	TranslateAPIKey  string
+	TranslateTimeout time.Duration
+	// Background translation: worker count, queue size and retries per text
+	TranslateWorkers int
+	TranslateQueue   int
+	TranslateRetries int
+	// DebugAddr is where /debug/vars is served, apart from the public API
+	DebugAddr string
 }
 
 var C AppConfig
@@ -28,22 +44,52 @@ func Load() {
 	_ = godotenv.Load()
 
 	port, _ := strconv.Atoi(os.Getenv("EMAIL_PORT"))
+	editWindow, err := time.ParseDuration(os.Getenv("EDIT_WINDOW"))
+	if err != nil || editWindow <= 0 {
+		editWindow = 15 * time.Minute
+	}
+	translateTimeout, err := time.ParseDuration(os.Getenv("TRANSLATE_TIMEOUT"))
+	if err != nil || translateTimeout <= 0 {
+		translateTimeout = 5 * time.Second
+	}
+	translateWorkers := envInt("TRANSLATE_WORKERS", 4)
+	translateQueue := envInt("TRANSLATE_QUEUE", 1000)
+	translateRetries, err := strconv.Atoi(os.Getenv("TRANSLATE_RETRIES"))
+	if err != nil || translateRetries < 0 {
+		translateRetries = 2
+	}
+	debugAddr := os.Getenv("DEBUG_ADDR")
+	if debugAddr == "" {
+		debugAddr = "127.0.0.1:6060"
+	}
 	baseURL := os.Getenv("BASE_URL")
 	if baseURL == "" {
 		baseURL = "http://localhost:5000"
 	}
 	C = AppConfig{
-		MongoURI:      os.Getenv("MONGODB_URI"),
-		MongoDB:       os.Getenv("MONGODB_DB"),
-		AccessSecret:  os.Getenv("JWT_ACCESS_SECRET"),
-		RefreshSecret: os.Getenv("JWT_REFRESH_SECRET"),
-		EmailHost:     os.Getenv("EMAIL_HOST"),
-		EmailPort:     port,
-		EmailUser:     os.Getenv("EMAIL_USER"),
-		EmailPass:     os.Getenv("EMAIL_PASS"),
-		ClientURL:     os.Getenv("CLIENT_URL"),
-		BaseURL:       baseURL,
-		Port:          os.Getenv("PORT"),
+		MongoURI:         os.Getenv("MONGODB_URI"),
+		MongoDB:          os.Getenv("MONGODB_DB"),
+		AccessSecret:     os.Getenv("JWT_ACCESS_SECRET"),
+		RefreshSecret:    os.Getenv("JWT_REFRESH_SECRET"),
+		EmailHost:        os.Getenv("EMAIL_HOST"),
+		EmailPort:        port,
+		EmailUser:        os.Getenv("EMAIL_USER"),
+		EmailPass:        os.Getenv("EMAIL_PASS"),
+		ClientURL:        os.Getenv("CLIENT_URL"),
+		BaseURL:          baseURL,
+		Port:             os.Getenv("PORT"),
+		Broker:           os.Getenv("BROKER"),
+		RedisURL:         os.Getenv("REDIS_URL"),
+		BrokerChannel:    os.Getenv("BROKER_CHANNEL"),
+		EditWindow:       editWindow,
+		Translator:       os.Getenv("TRANSLATOR"),
+		TranslateURL:     os.Getenv("TRANSLATE_URL"),
+		TranslateAPIKey:  os.Getenv("TRANSLATE_API_KEY"),
+		TranslateTimeout: translateTimeout,
+		TranslateWorkers: translateWorkers,
+		TranslateQueue:   translateQueue,
+		TranslateRetries: translateRetries,
+		DebugAddr:        debugAddr,
 		// no sendgrid key
 	}
 
@@ -52,3 +98,12 @@ func Load() {
 	}
 	log.Println("✅ Config loaded successfully")
 }
+
+// envInt reads a positive integer, falling back to def when unset or invalid.
+func envInt(key string, def int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventRetention is how long per-user events are kept for session resume.
+const EventRetention = 7 * 24 * time.Hour
+
+// ExpiryGrace is how long after expires_at Mongo's TTL monitor removes a
+// disappearing message. The app's purge job normally deletes it first (and
+// tells clients); the TTL index is the backstop.
+const ExpiryGrace = time.Hour
+
+// EnsureIndexes creates the indexes the app relies on. Index creation is
+// idempotent, so this is safe to run on every start.
+func EnsureIndexes(ctx context.Context) {
+	ensure(ctx, Messages(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "recipient_id", Value: 1}, {Key: "delivered", Value: 1}}},
+		{Keys: bson.D{{Key: "recipients", Value: 1}, {Key: "created_at", Value: 1}}},
+		// conversation list: last message and unread counts
+		{Keys: bson.D{{Key: "conversation_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		// history paging: created_at, then _id
+		{Keys: bson.D{{Key: "group_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "recipient_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "thread_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "mentions", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "files", Value: 1}}},
+		// full-text search; messages are multilingual, so no stemming or stop words
+		{
+			Keys:    bson.D{{Key: "content", Value: "text"}},
+			Options: options.Index().SetDefaultLanguage("none").SetLanguageOverride("text_search_language"),
+		},
+		{
+			Keys:    bson.D{{Key: "poll.closes_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(ExpiryGrace.Seconds())),
+		},
+	})
+	ensure(ctx, ReadCursors(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "conversation_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	ensure(ctx, Scheduled(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "send_at", Value: 1}}},
+		{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "status", Value: 1}, {Key: "send_at", Value: 1}}},
+	})
+	ensure(ctx, Events(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(EventRetention.Seconds())),
+		},
+		{Keys: bson.D{{Key: "message_id", Value: 1}}},
+	})
+}
+
+func ensure(ctx context.Context, coll *mongo.Collection, models []mongo.IndexModel) {
+	if _, err := coll.Indexes().CreateMany(ctx, models); err != nil {
+		log.Printf("⚠️ Failed to create indexes on %s: %v", coll.Name(), err)
+	}
+}
@@ -48,3 +48,8 @@ func Users() *mongo.Collection    { return Database.Collection("users") }
 func OTPs() *mongo.Collection     { return Database.Collection("email_otps") }
 func Messages() *mongo.Collection { return Database.Collection("messages") }
 func Groups() *mongo.Collection   { return Database.Collection("groups") }
+func Events() *mongo.Collection   { return Database.Collection("user_events") }
+func Counters() *mongo.Collection { return Database.Collection("counters") }
+
+func ReadCursors() *mongo.Collection { return Database.Collection("read_cursors") }
+func Scheduled() *mongo.Collection   { return Database.Collection("scheduled_messages") }
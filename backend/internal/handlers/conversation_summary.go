@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Presence reports whether a user has a live connection (the WS hub).
+type Presence interface {
+	IsOnline(userID string) bool
+}
+
+// previewLength caps the last-message preview shown in the conversation list.
+const previewLength = 80
+
+// lastMessageQueries bounds the per-conversation lookups lastMessages runs
+// at once.
+const lastMessageQueries = 8
+
+// lastMessage is the newest visible message of a conversation.
+type lastMessage struct {
+	MessageID primitive.ObjectID `bson:"_id"`
+	SenderID  string             `bson:"sender_id"`
+	Content   string             `bson:"content"`
+	Files     []string           `bson:"files"`
+	Deleted   bool               `bson:"deleted"`
+	Poll      *struct {
+		Question string `bson:"question"`
+	} `bson:"poll"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// conversationKey is the aggregation expression naming a message's
+// conversation: its conversation_id, else its group_id, else (for DMs sent
+// before messages carried conversation_id) the sender/recipient pair as
+// built by pairKey.
+var conversationKey = bson.M{"$ifNull": bson.A{"$conversation_id", bson.M{"$ifNull": bson.A{"$group_id",
+	bson.M{"$cond": bson.A{
+		bson.M{"$lt": bson.A{"$sender_id", "$recipient_id"}},
+		bson.M{"$concat": bson.A{"$sender_id", ":", "$recipient_id"}},
+		bson.M{"$concat": bson.A{"$recipient_id", ":", "$sender_id"}},
+	}},
+}}}}
+
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+
+// conversationScope returns $or clauses matching the messages of one
+// conversation, including those stored before messages carried
+// conversation_id: by group_id for a group, by the sender/recipient pair
+// for a DM with other. Like messageInConversation in the ws package. With
+// incoming set, only a DM's messages from other are matched. Each clause is
+// served by its own index, sorted by created_at.
+func conversationScope(userID, convID, other string, incoming bool) []bson.M {
+	legacy := func(extra bson.M) bson.M {
+		extra["conversation_id"] = bson.M{"$exists": false}
+		return extra
+	}
+	scope := []bson.M{{"conversation_id": convID}}
+	if other == "" {
+		return append(scope, legacy(bson.M{"group_id": convID}))
+	}
+	scope = append(scope, legacy(bson.M{"sender_id": other, "recipient_id": userID}))
+	if !incoming {
+		scope = append(scope, legacy(bson.M{"sender_id": userID, "recipient_id": other}))
+	}
+	return scope
+}
+
+// conversationsByKey maps the keys conversationKey yields back to
+// conversation IDs; others maps DM conversations to the other member.
+func conversationsByKey(userID string, convIDs []string, others map[string]string) map[string]string {
+	byKey := make(map[string]string, len(convIDs))
+	for _, id := range convIDs {
+		byKey[id] = id
+		if other, ok := others[id]; ok {
+			byKey[pairKey(userID, other)] = id
+		}
+	}
+	return byKey
+}
+
+// lastMessages finds the newest message of every conversation, skipping
+// messages the user hid and thread replies. Each conversation is one
+// indexed query returning a single message, so the cost doesn't grow with
+// the history. others maps DM conversations to the other member.
+func (h *UserHandler) lastMessages(ctx context.Context, userID string, convIDs []string, others map[string]string) (map[string]lastMessage, error) {
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"sender_id": 1, "content": 1, "files": 1, "deleted": 1, "poll.question": 1, "created_at": 1})
+
+	var (
+		mu       sync.Mutex
+		out      = make(map[string]lastMessage, len(convIDs))
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, lastMessageQueries)
+	)
+	for _, id := range convIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var m lastMessage
+			err := h.messagesCollection.FindOne(ctx, bson.M{
+				"$or":        conversationScope(userID, id, others[id], false),
+				"hidden_for": bson.M{"$ne": userID},
+				"thread_id":  bson.M{"$exists": false},
+			}, opts).Decode(&m)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				out[id] = m
+			case !errors.Is(err, mongo.ErrNoDocuments) && firstErr == nil:
+				firstErr = err
+			}
+		}(id)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// unreadCounts counts, per conversation, the messages from others after the
+// user's read cursor, in a single aggregation. others maps DM conversations
+// to the other member.
+func (h *UserHandler) unreadCounts(ctx context.Context, userID string, convIDs []string, others map[string]string) (map[string]int, error) {
+	if len(convIDs) == 0 {
+		return map[string]int{}, nil
+	}
+	cur, err := h.readCursors.Find(ctx, bson.M{"user_id": userID, "conversation_id": bson.M{"$in": convIDs}},
+		options.Find().SetProjection(bson.M{"conversation_id": 1, "message_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var cursors []struct {
+		ConversationID string             `bson:"conversation_id"`
+		MessageID      primitive.ObjectID `bson:"message_id"`
+	}
+	if err := cur.All(ctx, &cursors); err != nil {
+		return nil, err
+	}
+
+	readUpTo := make(map[string]primitive.ObjectID, len(cursors))
+	for _, c := range cursors {
+		readUpTo[c.ConversationID] = c.MessageID
+	}
+	scopes := make([]bson.M, 0, len(convIDs))
+	for _, id := range convIDs {
+		for _, clause := range conversationScope(userID, id, others[id], true) {
+			if last, ok := readUpTo[id]; ok {
+				clause["_id"] = bson.M{"$gt": last}
+			}
+			scopes = append(scopes, clause)
+		}
+	}
+
+	agg, err := h.messagesCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"$or":        scopes,
+			"sender_id":  bson.M{"$ne": userID},
+			"hidden_for": bson.M{"$ne": userID},
+			"deleted":    bson.M{"$ne": true},
+			"thread_id":  bson.M{"$exists": false},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": conversationKey, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Key   string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := agg.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	byKey := conversationsByKey(userID, convIDs, others)
+	out := make(map[string]int, len(rows))
+	for _, row := range rows {
+		if id, ok := byKey[row.Key]; ok {
+			out[id] += row.Count
+		}
+	}
+	return out, nil
+}
+
+// displayNames loads the names of many users at once.
+func (h *UserHandler) displayNames(ctx context.Context, userIDs []string) (map[string]string, error) {
+	oids := make([]primitive.ObjectID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	names := make(map[string]string, len(oids))
+	if len(oids) == 0 {
+		return names, nil
+	}
+	cur, err := h.userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": oids}},
+		options.Find().SetProjection(bson.M{"name": 1, "display_name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.DisplayName != "" {
+			names[u.ID] = u.DisplayName
+		} else {
+			names[u.ID] = u.Name
+		}
+	}
+	return names, nil
+}
+
+// preview is the one-line text shown for a conversation's last message.
+func (m lastMessage) preview() string {
+	switch {
+	case m.Deleted:
+		return "🚫 Message deleted"
+	case m.Poll != nil && m.Poll.Question != "":
+		return "📊 " + truncate(m.Poll.Question)
+	case strings.TrimSpace(m.Content) != "":
+		return truncate(strings.Join(strings.Fields(m.Content), " "))
+	case len(m.Files) > 0:
+		return "📎 Attachment"
+	}
+	return ""
+}
+
+func truncate(s string) string {
+	if utf8.RuneCountInString(s) <= previewLength {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:previewLength]) + "…"
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -28,13 +29,17 @@ type UserHandler struct {
 	userCollection     *mongo.Collection
 	dmCollection       *mongo.Collection
 	messagesCollection *mongo.Collection
+	readCursors        *mongo.Collection
+	presence           Presence
 }
 
-func NewUserHandler(userCollection, dmCollection, messagesCollection *mongo.Collection) *UserHandler {
+func NewUserHandler(userCollection, dmCollection, messagesCollection, readCursors *mongo.Collection, presence Presence) *UserHandler {
 	return &UserHandler{
 		userCollection:     userCollection,
 		dmCollection:       dmCollection,
 		messagesCollection: messagesCollection,
+		readCursors:        readCursors,
+		presence:           presence,
 	}
 }
 
@@ -187,7 +192,7 @@ func (h *UserHandler) CreateDMConversation(w http.ResponseWriter, r *http.Reques
 	// create new DM conversation
 	now := time.Now().UTC()
 	newConv := models.Group{
-		Name:      "DM", // Simple name for DMs
+		Name:      models.DMName, // Simple name for DMs
 		Members:   []string{currentUserID, targetUserID},
 		CreatedBy: currentUserID,
 		CreatedAt: now,
@@ -253,82 +258,87 @@ func (h *UserHandler) GetUserConversations(w http.ResponseWriter, r *http.Reques
 	}
 
 	type ConversationResponse struct {
-		ID              string    `json:"id"`
-		Type            string    `json:"type"`
-		Name            string    `json:"name"`
-		Participants    []string  `json:"participants"`
-		LastMessage     any       `json:"lastMessage"`
-		LastMessageTime time.Time `json:"lastMessageTime"`
-		UnreadCount     int       `json:"unreadCount"`
-		IsOnline        bool      `json:"isOnline"`
-	}
-
-	response := make([]ConversationResponse, 0, len(conversations))
+		ID                string    `json:"id"`
+		Type              string    `json:"type"`
+		Name              string    `json:"name"`
+		Participants      []string  `json:"participants"`
+		LastMessage       any       `json:"lastMessage"` // preview text, null when empty
+		LastMessageID     string    `json:"lastMessageId,omitempty"`
+		LastMessageSender string    `json:"lastMessageSender,omitempty"`
+		LastMessageTime   time.Time `json:"lastMessageTime"`
+		UnreadCount       int       `json:"unreadCount"`
+		IsOnline          bool      `json:"isOnline"`
+	}
+
+	convIDs := make([]string, 0, len(conversations))
+	others := make(map[string]string, len(conversations)) // DM conversation -> other user
+	var otherIDs []string
 	for _, conv := range conversations {
-		// Determine conversation type and name
-		var convType string
-		var name string
-
-		// If the conversation has a name other than "DM", it's a group
-		// Otherwise, it's a DM (even if it has more than 2 members for some reason)
-		if conv.Name != "DM" && conv.Name != "" {
-			convType = "group"
-			name = conv.Name
-		} else {
-			convType = "dm"
-			// Find the other user
-			otherUserID := ""
-			for _, memberID := range conv.Members {
-				if memberID != currentUserID {
-					otherUserID = memberID
-					break
-				}
-			}
-
-			// Get other user's details
-			if otherUserID != "" {
-				var otherUser models.User
-				// Convert string ID to ObjectID for MongoDB query
-				objID, err := primitive.ObjectIDFromHex(otherUserID)
-				if err == nil {
-					userFilter := bson.M{"_id": objID}
-					if err := h.userCollection.FindOne(ctx, userFilter).Decode(&otherUser); err == nil {
-						// Use display name if available, fallback to name
-						if otherUser.DisplayName != "" {
-							name = otherUser.DisplayName
-						} else {
-							name = otherUser.Name
-						}
-					} else {
-						name = "Unknown User"
-					}
-				} else {
-					name = "Unknown User"
-				}
+		convIDs = append(convIDs, conv.ID)
+		if !conv.IsDM() {
+			continue
+		}
+		for _, memberID := range conv.Members {
+			if memberID != currentUserID {
+				others[conv.ID] = memberID
+				otherIDs = append(otherIDs, memberID)
+				break
 			}
 		}
+	}
 
-		// Get last message time
-		lastMessageTime := conv.CreatedAt
-		lastMessageFilter := bson.M{"group_id": conv.ID}
-		opts := options.FindOne().SetSort(bson.M{"created_at": -1})
-		var lastMsg models.Message
-		if err := h.messagesCollection.FindOne(ctx, lastMessageFilter, opts).Decode(&lastMsg); err == nil {
-			lastMessageTime = lastMsg.CreatedAt
-		}
+	// a few batched queries instead of several per conversation
+	names, err := h.displayNames(ctx, otherIDs)
+	if err != nil {
+		http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+		return
+	}
+	last, err := h.lastMessages(ctx, currentUserID, convIDs, others)
+	if err != nil {
+		http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+		return
+	}
+	unread, err := h.unreadCounts(ctx, currentUserID, convIDs, others)
+	if err != nil {
+		http.Error(w, "Failed to fetch conversations", http.StatusInternalServerError)
+		return
+	}
 
-		response = append(response, ConversationResponse{
+	response := make([]ConversationResponse, 0, len(conversations))
+	for _, conv := range conversations {
+		resp := ConversationResponse{
 			ID:              conv.ID,
-			Type:            convType,
-			Name:            name,
+			Type:            "group",
+			Name:            conv.Name,
 			Participants:    conv.Members,
-			LastMessage:     nil, // TODO: Get actual last message
-			LastMessageTime: lastMessageTime,
-			UnreadCount:     0,     // TODO: Calculate actual unread count
-			IsOnline:        false, // TODO: Check online status
-		})
+			LastMessageTime: conv.CreatedAt,
+			UnreadCount:     unread[conv.ID],
+		}
+		if conv.IsDM() {
+			other := others[conv.ID]
+			resp.Type = "dm"
+			resp.Name = names[other]
+			if resp.Name == "" {
+				resp.Name = "Unknown User"
+			}
+			resp.IsOnline = other != "" && h.presence.IsOnline(other)
+		}
+		if m, ok := last[conv.ID]; ok {
+			if p := m.preview(); p != "" {
+				resp.LastMessage = p
+			}
+			resp.LastMessageID = m.MessageID.Hex()
+			resp.LastMessageSender = m.SenderID
+			resp.LastMessageTime = m.CreatedAt
+		}
+		response = append(response, resp)
 	}
 
+	// most recently active first
+	sort.SliceStable(response, func(i, j int) bool {
+		return response[i].LastMessageTime.After(response[j].LastMessageTime)
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(response)
 }
@@ -0,0 +1,224 @@
+// Package langdetect guesses the language of short chat messages offline.
+// Non-Latin scripts are recognised by their Unicode ranges; Latin-script
+// languages are told apart by a character n-gram model built from the
+// samples embedded under corpus/.
+package langdetect
+
+import (
+	"embed"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// MinConfidence is the confidence below which callers should not trust a
+// detection and fall back to another hint (e.g. the user's language).
+const MinConfidence = 0.5
+
+// Result is a detected language code (as used in user profiles, e.g. "en")
+// and a confidence between 0 and 1.
+type Result struct {
+	Lang       string
+	Confidence float64
+}
+
+//go:embed corpus/*.txt
+var corpus embed.FS
+
+const (
+	maxN = 3
+	// fullLength is the number of letters from which a Latin-script guess
+	// gets full confidence; shorter texts are scaled down.
+	fullLength = 12
+)
+
+// scripts maps writing systems that identify a language on their own.
+// Han without kana is taken as Chinese.
+var scripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"hi", unicode.Devanagari},
+	{"ar", unicode.Arabic},
+	{"ru", unicode.Cyrillic},
+	{"ko", unicode.Hangul},
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"zh", unicode.Han},
+}
+
+// profile is the n-gram model of one language.
+type profile struct {
+	lang   string
+	counts map[string]float64
+	total  float64
+}
+
+var (
+	loadOnce sync.Once
+	profiles []*profile
+)
+
+func load() {
+	entries, err := corpus.ReadDir("corpus")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		b, err := corpus.ReadFile(path.Join("corpus", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		p := &profile{lang: strings.TrimSuffix(e.Name(), ".txt"), counts: map[string]float64{}}
+		for _, g := range ngrams(string(b)) {
+			p.counts[g]++
+			p.total++
+		}
+		profiles = append(profiles, p)
+	}
+}
+
+// Detect returns the most likely language of text, or an empty Result when
+// it has no letters to go on.
+func Detect(text string) Result {
+	text = stripNoise(text)
+
+	letters := 0
+	byScript := map[string]int{}
+	latin := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				byScript[s.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return Result{}
+	}
+
+	// Japanese mixes kana with Han; any kana makes it Japanese
+	if byScript["ja"] > 0 {
+		byScript["ja"] += byScript["zh"]
+		delete(byScript, "zh")
+	}
+	best, bestCount := "", 0
+	for lang, n := range byScript {
+		if n > bestCount {
+			best, bestCount = lang, n
+		}
+	}
+	if bestCount > latin {
+		return Result{Lang: best, Confidence: float64(bestCount) / float64(letters)}
+	}
+
+	lang, p := classify(text)
+	if lang == "" {
+		return Result{}
+	}
+	share := float64(latin) / float64(letters)
+	length := math.Min(1, float64(latin)/fullLength)
+	return Result{Lang: lang, Confidence: p * share * length}
+}
+
+// classify scores text against every Latin-script profile and returns the
+// best language with its posterior probability.
+func classify(text string) (string, float64) {
+	loadOnce.Do(load)
+	grams := ngrams(text)
+	if len(grams) == 0 || len(profiles) == 0 {
+		return "", 0
+	}
+
+	scores := make([]float64, len(profiles))
+	best := 0
+	for i, p := range profiles {
+		// add-one smoothing over a generous n-gram vocabulary
+		denom := math.Log(p.total + 10000)
+		for _, g := range grams {
+			scores[i] += math.Log(p.counts[g]+1) - denom
+		}
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	sum := 0.0
+	for _, s := range scores {
+		sum += math.Exp(s - scores[best])
+	}
+	return profiles[best].lang, 1 / sum
+}
+
+// ngrams returns the 1- to 3-letter sequences of every word, padded with a
+// space on both sides so word starts and endings count.
+func ngrams(text string) []string {
+	var out []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		runes := []rune(" " + strings.Trim(word, "'") + " ")
+		for n := 1; n <= maxN; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				g := string(runes[i : i+n])
+				if g != " " {
+					out = append(out, g)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// stripNoise drops links and @mentions, which say nothing about the language.
+func stripNoise(text string) string {
+	fields := strings.Fields(text)
+	kept := fields[:0]
+	for _, f := range fields {
+		if strings.HasPrefix(f, "@") || strings.Contains(f, "://") || strings.HasPrefix(f, "www.") {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return strings.Join(kept, " ")
+}
+
+// Same reports whether two language codes name the same language, ignoring
+// case and region (so "pt-BR" matches "pt").
+func Same(a, b string) bool {
+	return strings.EqualFold(base(a), base(b))
+}
+
+// ValidCode reports whether lang looks like a language code ("en", "pt-BR",
+// "zh_Hant"); such codes are also safe as MongoDB field names.
+func ValidCode(lang string) bool {
+	if len(lang) == 0 || len(lang) > 16 {
+		return false
+	}
+	for _, r := range lang {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func base(lang string) string {
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		return lang[:i]
+	}
+	return lang
+}
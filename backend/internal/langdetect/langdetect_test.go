@@ -0,0 +1,73 @@
+package langdetect
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		text string
+		want string
+	}{
+		// Latin script, told apart by the n-gram model
+		{"english", "Where are you going tonight? I think we should meet at the station.", "en"},
+		{"spanish", "¿Dónde estás? Creo que deberíamos vernos mañana en la estación.", "es"},
+		{"french", "Où es-tu ? Je pense qu'on devrait se retrouver demain à la gare.", "fr"},
+		{"german", "Wo bist du? Ich glaube, wir sollten uns morgen am Bahnhof treffen.", "de"},
+		{"italian", "Dove sei? Penso che dovremmo vederci domani alla stazione.", "it"},
+		{"portuguese", "Onde você está? Acho que deveríamos nos encontrar amanhã na estação.", "pt"},
+
+		// scripts that identify the language on their own
+		{"hindi", "नमस्ते, आप कैसे हैं?", "hi"},
+		{"arabic", "مرحبا، كيف حالك؟", "ar"},
+		{"russian", "Привет, как дела?", "ru"},
+		{"korean", "안녕하세요, 잘 지내세요?", "ko"},
+		{"japanese", "こんにちは、元気ですか？", "ja"},
+		{"chinese", "你好，你今天怎么样？", "zh"},
+
+		// mixed scripts: the dominant one wins, kana makes Han Japanese
+		{"latin with han and kana", "I love 寿司 and ラーメン so much", "en"},
+		{"kana with latin", "今日は sushi を食べました", "ja"},
+		{"cyrillic with latin", "Привет, как дела? see you", "ru"},
+		{"spanish with han", "Hola, ¿cómo estás? 你好", "es"},
+
+		// links and mentions don't count
+		{"noise stripped", "@maria mira esto https://example.com/video es lo que te decía ayer", "es"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Detect(tc.text)
+			if got.Lang != tc.want || got.Confidence < MinConfidence {
+				t.Errorf("Detect(%q) = %+v, want %s with confidence >= %v", tc.text, got, tc.want, MinConfidence)
+			}
+		})
+	}
+}
+
+func TestDetectNothingToGoOn(t *testing.T) {
+	// too short, ambiguous or letterless: callers must fall back to
+	// another hint, so the result is empty or below MinConfidence
+	for _, text := range []string{
+		"", "?!", "123 456", "👍", "@bob https://example.com",
+		"ok", "hi", "no", "lol", "xD", "haha", "hmm ok", "okay 👍", "taxi", "ciao", "merci",
+	} {
+		if got := Detect(text); got.Lang != "" && got.Confidence >= MinConfidence {
+			t.Errorf("Detect(%q) = %+v, want no confident detection", text, got)
+		}
+	}
+}
+
+func TestSame(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"en", "en", true},
+		{"pt-BR", "pt", true},
+		{"zh_Hant", "ZH", true},
+		{"en", "es", false},
+		{"", "en", false},
+	} {
+		if got := Same(tc.a, tc.b); got != tc.want {
+			t.Errorf("Same(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -1,15 +1,15 @@
 package messages
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
-	"time"
 
 	"realtime-chat/internal/auth"
 	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
 
+	"github.com/go-chi/chi/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -46,67 +46,44 @@ func userInGroup(r *http.Request, groupID, userID string) (bool, error) {
 	return false, nil
 }
 
-// GET /messages/dm?user_id=<other>&limit=50
-func GetDMHistory(w http.ResponseWriter, r *http.Request) {
+// GET /messages/dm?user_id=<other>&limit=50[&before=|&after=|&around=][&lang=]
+func (a *HistoryAPI) GetDMHistory(w http.ResponseWriter, r *http.Request) {
 	me := auth.UserIDFromContext(r)
 	other := r.URL.Query().Get("user_id")
 	if me == "" || other == "" {
 		http.Error(w, "user_id required", http.StatusBadRequest)
 		return
 	}
-	limit := parseLimit(r, 50)
+	lang, err := historyLang(r, me)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	filter := bson.M{
 		"$or": []bson.M{
 			{"sender_id": me, "recipient_id": other},
 			{"sender_id": other, "recipient_id": me},
 		},
+		// messages I deleted for myself
+		"hidden_for": bson.M{"$ne": me},
+		// thread replies are loaded through /messages/thread/{id}
+		"thread_id": bson.M{"$exists": false},
 	}
-	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
 
-	cur, err := db.Messages().Find(r.Context(), filter, opts)
+	page, err := loadPage(r, filter)
 	if err != nil {
-		http.Error(w, "db error", http.StatusInternalServerError)
+		writePageError(w, err)
 		return
 	}
-	defer cur.Close(r.Context())
-
-	var out []bson.M
-	if err := cur.All(r.Context(), &out); err != nil {
-		http.Error(w, "decode error", http.StatusInternalServerError)
-		return
-	}
-
-	// Resolve reply_sender ObjectIDs to display names for readability
-	for i := range out {
-		if v, ok := out[i]["reply_sender"].(string); ok && v != "" {
-			if oid, err := primitive.ObjectIDFromHex(v); err == nil {
-				var u struct {
-					DisplayName string `bson:"display_name"`
-					Name        string `bson:"name"`
-					ID          string `bson:"_id"`
-				}
-				ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
-				_ = db.Users().FindOne(ctx, bson.M{"_id": oid}).Decode(&u)
-				cancel()
-				if u.DisplayName != "" {
-					out[i]["reply_sender"] = u.DisplayName
-				} else if u.Name != "" {
-					out[i]["reply_sender"] = u.Name
-				}
-			}
-		}
-	}
-
+	page.Lang = lang
+	a.translatePage(r.Context(), page.Messages, lang)
 	w.Header().Set("Content-Type", "application/json")
-	if out == nil {
-		out = []bson.M{}
-	}
-	json.NewEncoder(w).Encode(out)
+	json.NewEncoder(w).Encode(page)
 }
 
-// GET /messages/group?group_id=<id>&limit=50
-func GetGroupHistory(w http.ResponseWriter, r *http.Request) {
+// GET /messages/group?group_id=<id>&limit=50[&before=|&after=|&around=][&lang=]
+func (a *HistoryAPI) GetGroupHistory(w http.ResponseWriter, r *http.Request) {
 	me := auth.UserIDFromContext(r)
 	groupID := r.URL.Query().Get("group_id")
 	if groupID == "" {
@@ -122,49 +99,150 @@ func GetGroupHistory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "forbidden: not a group member", http.StatusForbidden)
 		return
 	}
+	lang, err := historyLang(r, me)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{
+		"group_id":   groupID,
+		"hidden_for": bson.M{"$ne": me},
+		"thread_id":  bson.M{"$exists": false},
+	}
+
+	page, err := loadPage(r, filter)
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+	page.Lang = lang
+	a.translatePage(r.Context(), page.Messages, lang)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// GET /messages/thread/{id}?after=<reply id>&limit=50
+// Returns the thread root and its replies oldest first; pass the last reply
+// ID as after= to load the next page.
+func GetThread(w http.ResponseWriter, r *http.Request) {
+	me := auth.UserIDFromContext(r)
+	rootID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid thread id", http.StatusBadRequest)
+		return
+	}
+
+	var root models.Message
+	if err := db.Messages().FindOne(r.Context(), bson.M{"_id": rootID, "$or": unexpired()}).Decode(&root); err != nil {
+		http.Error(w, "thread not found", http.StatusNotFound)
+		return
+	}
+	if root.GroupID != "" {
+		ok, err := userInGroup(r, root.GroupID, me)
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "forbidden: not a group member", http.StatusForbidden)
+			return
+		}
+	} else if root.SenderID != me && root.RecipientID != me {
+		http.Error(w, "forbidden: not a participant", http.StatusForbidden)
+		return
+	}
 
 	limit := parseLimit(r, 50)
 
-	filter := bson.M{"group_id": groupID}
-	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	filter := bson.M{"thread_id": rootID.Hex(), "hidden_for": bson.M{"$ne": me}, "$or": unexpired()}
+	if after := r.URL.Query().Get("after"); after != "" {
+		afterID, err := primitive.ObjectIDFromHex(after)
+		if err != nil {
+			http.Error(w, "invalid after id", http.StatusBadRequest)
+			return
+		}
+		filter["_id"] = bson.M{"$gt": afterID}
+	}
+	// fetch one extra to know whether another page exists
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(limit + 1)
 
 	cur, err := db.Messages().Find(r.Context(), filter, opts)
 	if err != nil {
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
 	}
-	defer cur.Close(r.Context())
-
-	var out []bson.M
-	if err := cur.All(r.Context(), &out); err != nil {
+	var replies []models.Message
+	if err := cur.All(r.Context(), &replies); err != nil {
 		http.Error(w, "decode error", http.StatusInternalServerError)
 		return
 	}
+	hasMore := int64(len(replies)) > limit
+	if hasMore {
+		replies = replies[:limit]
+	}
 
-	// Resolve reply_sender ObjectIDs to display names for readability
-	for i := range out {
-		if v, ok := out[i]["reply_sender"].(string); ok && v != "" {
-			if oid, err := primitive.ObjectIDFromHex(v); err == nil {
-				var u struct {
-					DisplayName string `bson:"display_name"`
-					Name        string `bson:"name"`
-					ID          string `bson:"_id"`
-				}
-				ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
-				_ = db.Users().FindOne(ctx, bson.M{"_id": oid}).Decode(&u)
-				cancel()
-				if u.DisplayName != "" {
-					out[i]["reply_sender"] = u.DisplayName
-				} else if u.Name != "" {
-					out[i]["reply_sender"] = u.Name
-				}
-			}
+	for _, id := range root.HiddenFor {
+		if id == me {
+			// the root was deleted for me; keep the thread but not its content
+			root = models.Message{ID: root.ID, ConversationID: root.ConversationID, GroupID: root.GroupID, Deleted: true}
+			break
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if out == nil {
-		out = []bson.M{}
+	json.NewEncoder(w).Encode(map[string]any{
+		"root":     toMessages(r.Context(), []models.Message{root})[0],
+		"replies":  toMessages(r.Context(), replies),
+		"has_more": hasMore,
+	})
+}
+
+// GET /me/mentions?before=<message id>&limit=50
+// Returns group messages that mention the caller, newest first; pass the
+// last ID as before= to load the next page.
+func GetMentions(w http.ResponseWriter, r *http.Request) {
+	me := auth.UserIDFromContext(r)
+	if me == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
 	}
-	json.NewEncoder(w).Encode(out)
+	limit := parseLimit(r, 50)
+
+	filter := bson.M{
+		"mentions":   me,
+		"hidden_for": bson.M{"$ne": me},
+		"deleted":    bson.M{"$ne": true},
+		"$or":        unexpired(),
+	}
+	if before := r.URL.Query().Get("before"); before != "" {
+		beforeID, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			http.Error(w, "invalid before id", http.StatusBadRequest)
+			return
+		}
+		filter["_id"] = bson.M{"$lt": beforeID}
+	}
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit + 1)
+
+	cur, err := db.Messages().Find(r.Context(), filter, opts)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	var out []models.Message
+	if err := cur.All(r.Context(), &out); err != nil {
+		http.Error(w, "decode error", http.StatusInternalServerError)
+		return
+	}
+	hasMore := int64(len(out)) > limit
+	if hasMore {
+		out = out[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"mentions": toMessages(r.Context(), out),
+		"has_more": hasMore,
+	})
 }
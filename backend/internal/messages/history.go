@@ -0,0 +1,277 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Message is a message as the history endpoints return it.
+type Message struct {
+	models.Message
+	// Reactions replaces the stored emoji -> user IDs map with per-emoji counts.
+	Reactions []models.ReactionSummary `json:"reactions,omitempty"`
+	// Original is the content as sent; Translated is the content in the
+	// page's language (the original when no translation is needed, or when
+	// it is still pending).
+	Original           string `json:"original,omitempty"`
+	Translated         string `json:"translated,omitempty"`
+	TranslationFailed  bool   `json:"translation_failed,omitempty"`
+	TranslationPending bool   `json:"translation_pending,omitempty"`
+}
+
+// Page is one page of conversation history, oldest message first.
+type Page struct {
+	Messages []Message `json:"messages"`
+	// HasMore reports more messages in the direction paged: older ones for
+	// the default and before=, newer ones for after=, either side for around=.
+	HasMore bool `json:"has_more"`
+	// HasOlder and HasNewer are set for around= only.
+	HasOlder bool `json:"has_older,omitempty"`
+	HasNewer bool `json:"has_newer,omitempty"`
+	// Lang is the language of the messages' translated text.
+	Lang string `json:"lang,omitempty"`
+}
+
+var (
+	errBadCursor      = errors.New("cursor must be a message id or an RFC 3339 timestamp")
+	errCursorNotFound = errors.New("cursor message not found in this conversation")
+	errManyCursors    = errors.New("use only one of before, after and around")
+)
+
+// cursor is a position in a conversation: a message, or a point in time when
+// id is zero. Messages are ordered by created_at, then _id.
+type cursor struct {
+	at time.Time
+	id primitive.ObjectID
+}
+
+// parseCursor reads a before/after/around value. Message IDs must belong to
+// the conversation selected by base.
+func parseCursor(ctx context.Context, base bson.M, v string, allowTime bool) (*cursor, error) {
+	if oid, err := primitive.ObjectIDFromHex(v); err == nil {
+		var m models.Message
+		err := db.Messages().FindOne(ctx, bson.M{"$and": []bson.M{base, {"_id": oid}}},
+			options.FindOne().SetProjection(bson.M{"created_at": 1})).Decode(&m)
+		if err != nil {
+			return nil, errCursorNotFound
+		}
+		return &cursor{at: m.CreatedAt, id: oid}, nil
+	}
+	if !allowTime {
+		return nil, errBadCursor
+	}
+	at, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	return &cursor{at: at}, nil
+}
+
+// olderThan matches messages strictly before c.
+func (c *cursor) olderThan() bson.M {
+	if c.id.IsZero() {
+		return bson.M{"created_at": bson.M{"$lt": c.at}}
+	}
+	return bson.M{"$or": []bson.M{
+		{"created_at": bson.M{"$lt": c.at}},
+		{"created_at": c.at, "_id": bson.M{"$lt": c.id}},
+	}}
+}
+
+// newerThan matches messages after c, and c itself when inclusive.
+func (c *cursor) newerThan(inclusive bool) bson.M {
+	if c.id.IsZero() {
+		return bson.M{"created_at": bson.M{"$gt": c.at}}
+	}
+	op := "$gt"
+	if inclusive {
+		op = "$gte"
+	}
+	return bson.M{"$or": []bson.M{
+		{"created_at": bson.M{"$gt": c.at}},
+		{"created_at": c.at, "_id": bson.M{op: c.id}},
+	}}
+}
+
+// unexpired matches messages whose disappearing timer has not run out. Mongo's
+// TTL monitor only removes them a while after expires_at, so reads filter
+// them out themselves.
+func unexpired() []bson.M {
+	return []bson.M{
+		{"expires_at": bson.M{"$exists": false}},
+		{"expires_at": bson.M{"$gt": time.Now().UTC()}},
+	}
+}
+
+// findRun loads up to limit messages matching filter, walking towards newer
+// messages or older ones, and reports whether more exist beyond them. The
+// result is in walking order.
+func findRun(ctx context.Context, filter bson.M, newer bool, limit int64) ([]models.Message, bool, error) {
+	dir := -1
+	if newer {
+		dir = 1
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(limit + 1)
+
+	cur, err := db.Messages().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	var out []models.Message
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, false, err
+	}
+	hasMore := int64(len(out)) > limit
+	if hasMore {
+		out = out[:limit]
+	}
+	return out, hasMore, nil
+}
+
+// loadPage serves the history endpoints: base selects the conversation and
+// the query's before, after or around picks the page.
+func loadPage(r *http.Request, base bson.M) (*Page, error) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	limit := parseLimit(r, 50)
+	base = bson.M{"$and": []bson.M{base, {"$or": unexpired()}}}
+
+	before, after, around := q.Get("before"), q.Get("after"), q.Get("around")
+	set := 0
+	for _, v := range []string{before, after, around} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errManyCursors
+	}
+
+	page := &Page{}
+	switch {
+	case around != "":
+		c, err := parseCursor(ctx, base, around, false)
+		if err != nil {
+			return nil, err
+		}
+		older, hasOlder, err := findRun(ctx, bson.M{"$and": []bson.M{base, c.olderThan()}}, false, limit/2)
+		if err != nil {
+			return nil, err
+		}
+		newer, hasNewer, err := findRun(ctx, bson.M{"$and": []bson.M{base, c.newerThan(true)}}, true, limit-limit/2)
+		if err != nil {
+			return nil, err
+		}
+		reverse(older)
+		page.Messages = toMessages(ctx, append(older, newer...))
+		page.HasOlder, page.HasNewer = hasOlder, hasNewer
+		page.HasMore = hasOlder || hasNewer
+
+	case after != "":
+		c, err := parseCursor(ctx, base, after, true)
+		if err != nil {
+			return nil, err
+		}
+		msgs, hasMore, err := findRun(ctx, bson.M{"$and": []bson.M{base, c.newerThan(false)}}, true, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages = toMessages(ctx, msgs)
+		page.HasMore = hasMore
+
+	default:
+		filter := base
+		if before != "" {
+			c, err := parseCursor(ctx, base, before, true)
+			if err != nil {
+				return nil, err
+			}
+			filter = bson.M{"$and": []bson.M{base, c.olderThan()}}
+		}
+		msgs, hasMore, err := findRun(ctx, filter, false, limit)
+		if err != nil {
+			return nil, err
+		}
+		reverse(msgs)
+		page.Messages = toMessages(ctx, msgs)
+		page.HasMore = hasMore
+	}
+	return page, nil
+}
+
+// writePageError maps loadPage errors to HTTP responses.
+func writePageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errBadCursor), errors.Is(err, errManyCursors):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errCursorNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, mongo.ErrNoDocuments):
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		http.Error(w, "db error", http.StatusInternalServerError)
+	}
+}
+
+// toMessages shapes stored messages for clients: reactions become counts,
+// polls show results instead of votes, and reply_sender ObjectIDs are
+// resolved to display names for readability.
+func toMessages(ctx context.Context, in []models.Message) []Message {
+	names := map[string]string{}
+	out := make([]Message, len(in))
+	for i, m := range in {
+		if m.Poll != nil {
+			m.Poll = m.Poll.View()
+		}
+		if m.ReplySender != "" {
+			name, ok := names[m.ReplySender]
+			if !ok {
+				name = displayName(ctx, m.ReplySender)
+				names[m.ReplySender] = name
+			}
+			m.ReplySender = name
+		}
+		out[i] = Message{Message: m, Reactions: models.SummarizeReactions(m.Reactions)}
+	}
+	return out
+}
+
+// displayName resolves a user ID to its display name, falling back to the
+// name; anything else is returned unchanged.
+func displayName(ctx context.Context, v string) string {
+	oid, err := primitive.ObjectIDFromHex(v)
+	if err != nil {
+		return v
+	}
+	var u models.User
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err := db.Users().FindOne(ctx, bson.M{"_id": oid}).Decode(&u); err != nil {
+		return v
+	}
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	return v
+}
+
+func reverse(msgs []models.Message) {
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+}
@@ -0,0 +1,92 @@
+package messages
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"realtime-chat/internal/auth"
+	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Pinned is a pin with its message, shaped like a history item.
+type Pinned struct {
+	models.Pin
+	Message Message `json:"message"`
+}
+
+// GET /conversations/{id}/pins[?lang=]
+// Pins come oldest first; messages deleted for everyone, hidden by the
+// caller or past their expiry are left out.
+func (a *HistoryAPI) GetPins(w http.ResponseWriter, r *http.Request) {
+	me := auth.UserIDFromContext(r)
+	oid, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid conversation ID", http.StatusBadRequest)
+		return
+	}
+	var conv models.Group
+	if err := db.Groups().FindOne(r.Context(), bson.M{"_id": oid}).Decode(&conv); err != nil {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return
+	}
+	if !contains(conv.Members, me) {
+		http.Error(w, "forbidden: not a conversation member", http.StatusForbidden)
+		return
+	}
+	lang, err := historyLang(r, me)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(conv.Pins))
+	for _, p := range conv.Pins {
+		if id, err := primitive.ObjectIDFromHex(p.MessageID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	cur, err := db.Messages().Find(r.Context(), bson.M{
+		"_id":        bson.M{"$in": ids},
+		"hidden_for": bson.M{"$ne": me},
+		"deleted":    bson.M{"$ne": true},
+		"$or":        unexpired(),
+	})
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	var stored []models.Message
+	if err := cur.All(r.Context(), &stored); err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	msgs := toMessages(r.Context(), stored)
+	a.translatePage(r.Context(), msgs, lang)
+
+	byID := make(map[string]Message, len(msgs))
+	for _, m := range msgs {
+		byID[m.ID] = m
+	}
+	out := make([]Pinned, 0, len(conv.Pins))
+	for _, p := range conv.Pins {
+		if m, ok := byID[p.MessageID]; ok {
+			out = append(out, Pinned{Pin: p, Message: m})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"realtime-chat/internal/auth"
+	"realtime-chat/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ScheduledAPI serves the caller's scheduled messages. Messages are created
+// over the WebSocket with schedule_message.
+type ScheduledAPI struct{ Hub *ws.Hub }
+
+// GET /messages/scheduled → pending scheduled messages, soonest first
+func (s *ScheduledAPI) List(w http.ResponseWriter, r *http.Request) {
+	me := auth.UserIDFromContext(r)
+	out, err := s.Hub.ScheduledMessages(me)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	if out == nil {
+		out = []ws.ScheduledMessage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// DELETE /messages/scheduled/{id} → cancels a pending scheduled message
+func (s *ScheduledAPI) Cancel(w http.ResponseWriter, r *http.Request) {
+	me := auth.UserIDFromContext(r)
+	err := s.Hub.CancelScheduled(me, chi.URLParam(r, "id"))
+	if errors.Is(err, ws.ErrScheduledNotFound) {
+		http.Error(w, "scheduled message not found or already sent", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"realtime-chat/internal/db"
+	"realtime-chat/internal/langdetect"
+	"realtime-chat/internal/models"
+	"realtime-chat/internal/ws"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pageTranslateTimeout bounds how long a history page waits for messages
+// that have no stored translation yet; those still running are returned in
+// the original language, marked translation_pending.
+const pageTranslateTimeout = 3 * time.Second
+
+var errBadLang = errors.New("invalid lang")
+
+// HistoryAPI serves DM and group history in the caller's language. The hub
+// translates messages so history shares live delivery's stored translations.
+type HistoryAPI struct{ Hub *ws.Hub }
+
+// historyLang returns the language to serve history in: ?lang= when given,
+// else the caller's profile language (empty if they never set one).
+func historyLang(r *http.Request, userID string) (string, error) {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if !langdetect.ValidCode(lang) {
+			return "", errBadLang
+		}
+		return lang, nil
+	}
+	return ProfileLang(r.Context(), userID), nil
+}
+
+// ProfileLang returns the language set in the user's profile, or "" when
+// they never set a valid one.
+func ProfileLang(ctx context.Context, userID string) string {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ""
+	}
+	var u models.User
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	err = db.Users().FindOne(ctx, bson.M{"_id": oid},
+		options.FindOne().SetProjection(bson.M{"language": 1})).Decode(&u)
+	if err != nil || !langdetect.ValidCode(u.Language) {
+		return ""
+	}
+	return u.Language
+}
+
+// translatePage sets Original and Translated on every message. Stored
+// translations are used when present; the rest go through the hub's
+// translation workers, waited for until ctx is done or pageTranslateTimeout
+// passes. Without a language, Translated is the original.
+func (a *HistoryAPI) translatePage(ctx context.Context, msgs []Message, lang string) {
+	ctx, cancel := context.WithTimeout(ctx, pageTranslateTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := range msgs {
+		m := &msgs[i]
+		m.Original, m.Translated = m.Content, m.Content
+		if lang == "" || m.Content == "" || !a.Hub.Translates(m.ContentLang, lang) {
+			continue
+		}
+		if t, ok := m.Translations[lang]; ok {
+			m.Translated = t
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t, ok, pending := a.Hub.TranslateMessage(ctx, &m.Message, lang)
+			m.Translated, m.TranslationPending = t, pending
+			m.TranslationFailed = !ok && !pending
+		}()
+	}
+	wg.Wait()
+}
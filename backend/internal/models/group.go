@@ -5,9 +5,28 @@ import "time"
 // Group stores group metadata and memberships.
 // Members are stored as string user IDs to match the rest of the codebase.
 type Group struct {
-	ID        string    `bson:"_id,omitempty" json:"id"`
-	Name      string    `bson:"name"          json:"name"`
-	Members   []string  `bson:"members"       json:"members"`      // user IDs (hex)
-	CreatedBy string    `bson:"created_by"    json:"created_by"`   // user ID (hex)
-	CreatedAt time.Time `bson:"created_at"    json:"created_at"`
+	ID         string    `bson:"_id,omitempty" json:"id"`
+	Name       string    `bson:"name"          json:"name"`
+	Members    []string  `bson:"members"       json:"members"`                       // user IDs (hex)
+	CreatedBy  string    `bson:"created_by"    json:"created_by"`                    // user ID (hex)
+	Admins     []string  `bson:"admins,omitempty" json:"admins,omitempty"`           // admin user IDs besides the creator
+	Pins       []Pin     `bson:"pins,omitempty" json:"pins,omitempty"`               // pinned messages, oldest first
+	MessageTTL int64     `bson:"message_ttl,omitempty" json:"message_ttl,omitempty"` // disappearing messages: seconds until new messages expire
+	CreatedAt  time.Time `bson:"created_at"    json:"created_at"`
+}
+
+// DMName is the name DM conversation documents are created with; any other
+// name makes a group.
+const DMName = "DM"
+
+// IsDM reports whether the conversation is a direct message.
+func (g *Group) IsDM() bool {
+	return g.Name == DMName
+}
+
+// Pin marks a message as pinned in a conversation.
+type Pin struct {
+	MessageID string    `bson:"message_id" json:"message_id"`
+	PinnedBy  string    `bson:"pinned_by"  json:"pinned_by"`
+	PinnedAt  time.Time `bson:"pinned_at"  json:"pinned_at"`
 }
@@ -10,11 +10,59 @@ type Message struct {
 	SenderID    string `bson:"sender_id"          json:"sender_id"`                  // user ID (hex)
 	RecipientID string `bson:"recipient_id,omitempty" json:"recipient_id,omitempty"` // DM target (hex)
 	GroupID     string `bson:"group_id,omitempty" json:"group_id,omitempty"`         // group ID (hex)
-	Content     string `bson:"content"            json:"content"`
+	// ConversationID is the DM conversation document ID, or the group ID for group messages.
+	ConversationID string `bson:"conversation_id,omitempty" json:"conversation_id,omitempty"`
+	Content        string `bson:"content"            json:"content"`
 	// Reply metadata (optional)
-	ReplyTo     string    `bson:"reply_to,omitempty" json:"reply_to,omitempty"`
-	ReplyText   string    `bson:"reply_text,omitempty" json:"reply_text,omitempty"`
-	ReplySender string    `bson:"reply_sender,omitempty" json:"reply_sender,omitempty"`
-	ContentLang string    `bson:"content_lang"       json:"content_lang"` // e.g. "en", "hi"
-	CreatedAt   time.Time `bson:"created_at"         json:"created_at"`
+	ReplyTo     string   `bson:"reply_to,omitempty" json:"reply_to,omitempty"`
+	ReplyText   string   `bson:"reply_text,omitempty" json:"reply_text,omitempty"`
+	ReplySender string   `bson:"reply_sender,omitempty" json:"reply_sender,omitempty"`
+	ContentLang string   `bson:"content_lang"       json:"content_lang"` // e.g. "en", "hi"
+	Files       []string `bson:"files,omitempty" json:"files,omitempty"`
+	// ContentLangConfidence is how sure language detection was (0-1).
+	ContentLangConfidence float64 `bson:"content_lang_confidence,omitempty" json:"content_lang_confidence,omitempty"`
+	// Delivery state of DMs
+	Delivered   bool       `bson:"delivered,omitempty" json:"delivered,omitempty"`
+	DeliveredAt *time.Time `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	// Edit history, oldest first; Content holds the latest text.
+	EditedAt *time.Time `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	Edits    []Revision `bson:"edits,omitempty" json:"edits,omitempty"`
+	// HiddenFor lists users who deleted the message for themselves; Deleted
+	// marks a tombstone whose content was removed for everyone.
+	HiddenFor []string   `bson:"hidden_for,omitempty" json:"-"`
+	Deleted   bool       `bson:"deleted,omitempty" json:"deleted,omitempty"`
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	// Reactions maps an emoji to the IDs of the users who reacted with it.
+	Reactions map[string][]string `bson:"reactions,omitempty" json:"reactions,omitempty"`
+	// Threads: replies point at their root; roots track the reply count.
+	ThreadID    string     `bson:"thread_id,omitempty" json:"thread_id,omitempty"`
+	ReplyCount  int        `bson:"reply_count,omitempty" json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `bson:"last_reply_at,omitempty" json:"last_reply_at,omitempty"`
+	// Mentions holds the user IDs @mentioned in a group message.
+	Mentions []string `bson:"mentions,omitempty" json:"mentions,omitempty"`
+	// ForwardedFrom is set on copies made by forwarding a message.
+	ForwardedFrom *ForwardedFrom `bson:"forwarded_from,omitempty" json:"forwarded_from,omitempty"`
+	// ExpiresAt is set in conversations with disappearing messages.
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	// Poll is set on poll messages in groups.
+	Poll *Poll `bson:"poll,omitempty" json:"poll,omitempty"`
+	// Translations holds the content already translated into other
+	// languages, keyed by language code.
+	Translations map[string]string `bson:"translations,omitempty" json:"translations,omitempty"`
+	CreatedAt    time.Time         `bson:"created_at"         json:"created_at"`
+}
+
+// Revision is a previous version of an edited message.
+type Revision struct {
+	Content     string    `bson:"content"      json:"content"`
+	ContentLang string    `bson:"content_lang" json:"content_lang"`
+	ReplacedAt  time.Time `bson:"replaced_at"  json:"replaced_at"`
+}
+
+// ForwardedFrom records where a forwarded message originally came from.
+type ForwardedFrom struct {
+	MessageID      string `bson:"message_id"                json:"message_id"`
+	SenderID       string `bson:"sender_id"                 json:"sender_id"`
+	ConversationID string `bson:"conversation_id,omitempty" json:"conversation_id,omitempty"`
+	GroupID        string `bson:"group_id,omitempty"        json:"group_id,omitempty"`
 }
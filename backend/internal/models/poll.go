@@ -0,0 +1,67 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Poll is a question with fixed options attached to a group message.
+type Poll struct {
+	Question  string     `bson:"question"            json:"question"`
+	Options   []string   `bson:"options"             json:"options"`
+	Multi     bool       `bson:"multi,omitempty"     json:"multi,omitempty"`     // several options may be chosen
+	Anonymous bool       `bson:"anonymous,omitempty" json:"anonymous,omitempty"` // results never show who voted
+	ClosesAt  *time.Time `bson:"closes_at,omitempty" json:"closes_at,omitempty"`
+	Closed    bool       `bson:"closed,omitempty"    json:"closed,omitempty"`
+	// Votes maps a voter's user ID to the option indexes they chose. It is
+	// never sent to clients.
+	Votes map[string][]int `bson:"votes,omitempty" json:"-"`
+	// Results and TotalVoters are computed live while the poll is open and
+	// persisted once it closes.
+	Results     []PollResult `bson:"results,omitempty"      json:"results,omitempty"`
+	TotalVoters int          `bson:"total_voters,omitempty" json:"total_voters"`
+}
+
+// PollResult is the tally of one poll option.
+type PollResult struct {
+	Option int      `bson:"option"           json:"option"`
+	Text   string   `bson:"text"             json:"text"`
+	Count  int      `bson:"count"            json:"count"`
+	Voters []string `bson:"voters,omitempty" json:"voters,omitempty"` // empty for anonymous polls
+}
+
+// Tally counts the votes per option, in option order. Voters are listed
+// (sorted) unless the poll is anonymous.
+func (p *Poll) Tally() []PollResult {
+	out := make([]PollResult, len(p.Options))
+	for i, text := range p.Options {
+		out[i] = PollResult{Option: i, Text: text}
+	}
+	for voter, choices := range p.Votes {
+		for _, c := range choices {
+			if c < 0 || c >= len(out) {
+				continue
+			}
+			out[c].Count++
+			if !p.Anonymous {
+				out[c].Voters = append(out[c].Voters, voter)
+			}
+		}
+	}
+	for i := range out {
+		sort.Strings(out[i].Voters)
+	}
+	return out
+}
+
+// View returns the poll as clients see it: current results while open, the
+// persisted ones once closed, and no raw votes.
+func (p *Poll) View() *Poll {
+	v := *p
+	v.Votes = nil
+	if !p.Closed {
+		v.Results = p.Tally()
+		v.TotalVoters = len(p.Votes)
+	}
+	return &v
+}
@@ -0,0 +1,29 @@
+package models
+
+import "sort"
+
+// ReactionSummary aggregates one emoji's reactions on a message.
+type ReactionSummary struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// SummarizeReactions turns the stored emoji -> user IDs map into a list,
+// most used first (ties broken by emoji so the order is stable).
+func SummarizeReactions(reactions map[string][]string) []ReactionSummary {
+	out := make([]ReactionSummary, 0, len(reactions))
+	for emoji, users := range reactions {
+		if len(users) == 0 {
+			continue
+		}
+		out = append(out, ReactionSummary{Emoji: emoji, Count: len(users), UserIDs: users})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Emoji < out[j].Emoji
+	})
+	return out
+}
@@ -16,4 +16,12 @@ type User struct {
 	CreatedAt   time.Time  `bson:"created_at"     json:"created_at"`
 	UpdatedAt   *time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
 	LastSeenAt  *time.Time `bson:"last_seen_at,omitempty" json:"last_seen_at,omitempty"`
+	// ReadReceipts controls whether others see when this user read their
+	// messages. nil means the default (enabled).
+	ReadReceipts *bool `bson:"read_receipts,omitempty" json:"read_receipts,omitempty"`
+}
+
+// SendsReadReceipts reports the user's read receipt preference.
+func (u *User) SendsReadReceipts() bool {
+	return u.ReadReceipts == nil || *u.ReadReceipts
 }
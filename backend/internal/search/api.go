@@ -0,0 +1,190 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"realtime-chat/internal/auth"
+	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type API struct{ Searcher Searcher }
+
+// Conversation tells the client where a hit lives.
+type Conversation struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // "dm" | "group"
+	Name string `json:"name"`
+}
+
+// Result is one search hit as returned to clients.
+type Result struct {
+	ID           string       `json:"id"`
+	Conversation Conversation `json:"conversation"`
+	SenderID     string       `json:"sender_id"`
+	SenderName   string       `json:"sender_name"`
+	Snippet      string       `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+	Files        []string     `json:"files,omitempty"`
+	ThreadID     string       `json:"thread_id,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Score        float64      `json:"score"`
+}
+
+// GET /messages/search?q=<text>[&conversation_id=&sender_id=&from=&to=&has=file&limit=20]
+// q may contain has:file; from/to are RFC 3339 times.
+func (a *API) Search(w http.ResponseWriter, r *http.Request) {
+	me := auth.UserIDFromContext(r)
+	params := r.URL.Query()
+
+	q := Query{
+		UserID:         me,
+		ConversationID: params.Get("conversation_id"),
+		SenderID:       params.Get("sender_id"),
+		HasFile:        params.Get("has") == "file",
+		Limit:          20,
+	}
+	ParseText(params.Get("q"), &q)
+	if q.Text == "" {
+		http.Error(w, "q required", http.StatusBadRequest)
+		return
+	}
+	if l, err := strconv.ParseInt(params.Get("limit"), 10, 64); err == nil && l > 0 && l <= 50 {
+		q.Limit = l
+	}
+	for name, dst := range map[string]**time.Time{"from": &q.From, "to": &q.To} {
+		v := params.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		*dst = &t
+	}
+
+	groups, err := memberOf(r.Context(), me)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	for _, g := range groups {
+		q.GroupIDs = append(q.GroupIDs, g.ID)
+	}
+
+	hits, err := a.Searcher.Search(r.Context(), q)
+	if errors.Is(err, ErrEmptyQuery) {
+		http.Error(w, "q required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "search error", http.StatusInternalServerError)
+		return
+	}
+
+	out := describe(r.Context(), me, hits, groups, Terms(q.Text))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": out})
+}
+
+// memberOf loads the conversations the user belongs to.
+func memberOf(ctx context.Context, userID string) ([]models.Group, error) {
+	cur, err := db.Groups().Find(ctx, bson.M{"members": userID},
+		options.Find().SetProjection(bson.M{"name": 1, "members": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Group
+	err = cur.All(ctx, &out)
+	return out, err
+}
+
+// describe turns hits into results with snippets, sender names and the
+// conversation each one belongs to.
+func describe(ctx context.Context, me string, hits []Hit, groups []models.Group, terms []string) []Result {
+	convs := make(map[string]models.Group, len(groups))
+	for _, g := range groups {
+		convs[g.ID] = g
+	}
+
+	// one lookup for every user we need a name for
+	var ids []string
+	for _, h := range hits {
+		ids = append(ids, h.Message.SenderID)
+		if h.Message.GroupID == "" {
+			ids = append(ids, h.Message.RecipientID)
+		}
+	}
+	names := userNames(ctx, ids)
+
+	out := make([]Result, 0, len(hits))
+	for _, h := range hits {
+		m := h.Message
+		conv := Conversation{ID: m.ConversationID, Type: "dm"}
+		if m.GroupID != "" {
+			conv = Conversation{ID: m.GroupID, Type: "group", Name: convs[m.GroupID].Name}
+		} else {
+			other := m.RecipientID
+			if other == me {
+				other = m.SenderID
+			}
+			conv.Name = names[other]
+		}
+		out = append(out, Result{
+			ID:           m.ID,
+			Conversation: conv,
+			SenderID:     m.SenderID,
+			SenderName:   names[m.SenderID],
+			Snippet:      Snippet(m.Content, terms),
+			Files:        m.Files,
+			ThreadID:     m.ThreadID,
+			CreatedAt:    m.CreatedAt,
+			Score:        h.Score,
+		})
+	}
+	return out
+}
+
+// userNames maps user IDs to display names (falling back to name, then email).
+func userNames(ctx context.Context, ids []string) map[string]string {
+	names := make(map[string]string, len(ids))
+	oids := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	if len(oids) == 0 {
+		return names
+	}
+	cur, err := db.Users().Find(ctx, bson.M{"_id": bson.M{"$in": oids}},
+		options.Find().SetProjection(bson.M{"name": 1, "display_name": 1, "email": 1}))
+	if err != nil {
+		return names
+	}
+	var users []models.User
+	if err := cur.All(ctx, &users); err != nil {
+		return names
+	}
+	for _, u := range users {
+		switch {
+		case u.DisplayName != "":
+			names[u.ID] = u.DisplayName
+		case u.Name != "":
+			names[u.ID] = u.Name
+		default:
+			names[u.ID] = u.Email
+		}
+	}
+	return names
+}
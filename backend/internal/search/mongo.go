@@ -0,0 +1,87 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"realtime-chat/internal/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo searches message content through the text index on messages.content.
+type Mongo struct{}
+
+func NewMongo() *Mongo { return &Mongo{} }
+
+func (Mongo) Search(ctx context.Context, q Query) ([]Hit, error) {
+	if q.Text == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	scope := []bson.M{
+		{"sender_id": q.UserID, "recipient_id": bson.M{"$exists": true}},
+		{"recipient_id": q.UserID},
+	}
+	if len(q.GroupIDs) > 0 {
+		scope = append(scope, bson.M{"group_id": bson.M{"$in": q.GroupIDs}})
+	}
+	// disappearing messages stay in the collection until the TTL monitor
+	// gets to them, so expired ones are filtered out explicitly
+	live := []bson.M{
+		{"expires_at": bson.M{"$exists": false}},
+		{"expires_at": bson.M{"$gt": time.Now().UTC()}},
+	}
+	filter := bson.M{
+		"$text":      bson.M{"$search": q.Text},
+		"$and":       []bson.M{{"$or": scope}, {"$or": live}},
+		"hidden_for": bson.M{"$ne": q.UserID},
+		"deleted":    bson.M{"$ne": true},
+	}
+	if q.ConversationID != "" {
+		filter["conversation_id"] = q.ConversationID
+	}
+	if q.SenderID != "" {
+		filter["sender_id"] = q.SenderID
+	}
+	if q.From != nil || q.To != nil {
+		created := bson.M{}
+		if q.From != nil {
+			created["$gte"] = *q.From
+		}
+		if q.To != nil {
+			created["$lte"] = *q.To
+		}
+		filter["created_at"] = created
+	}
+	if q.HasFile {
+		filter["files.0"] = bson.M{"$exists": true}
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "created_at", Value: -1}}).
+		SetLimit(q.Limit)
+
+	cur, err := db.Messages().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var hits []Hit
+	for cur.Next(ctx) {
+		var h Hit
+		if err := cur.Decode(&h.Message); err != nil {
+			return nil, err
+		}
+		var s struct {
+			Score float64 `bson:"score"`
+		}
+		_ = cur.Decode(&s)
+		h.Score = s.Score
+		hits = append(hits, h)
+	}
+	return hits, cur.Err()
+}
@@ -0,0 +1,69 @@
+// Package search finds messages by content across the conversations a user
+// belongs to. Backends implement Searcher; the default one uses a MongoDB
+// text index on messages.
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"realtime-chat/internal/models"
+)
+
+var ErrEmptyQuery = errors.New("empty search query")
+
+// Query is a search request. UserID and GroupIDs scope it: only DMs the user
+// sent or received and messages of those groups can match.
+type Query struct {
+	Text     string
+	UserID   string
+	GroupIDs []string
+
+	// optional filters
+	ConversationID string
+	SenderID       string
+	From, To       *time.Time
+	HasFile        bool
+
+	Limit int64
+}
+
+// Hit is one matching message.
+type Hit struct {
+	Message models.Message
+	Score   float64
+}
+
+// Searcher runs message searches.
+type Searcher interface {
+	Search(ctx context.Context, q Query) ([]Hit, error)
+}
+
+// ParseText splits operators out of a raw query string: has:file sets
+// HasFile and the remaining words become Text.
+func ParseText(raw string, q *Query) {
+	var words []string
+	for _, w := range strings.Fields(raw) {
+		if strings.EqualFold(w, "has:file") {
+			q.HasFile = true
+			continue
+		}
+		words = append(words, w)
+	}
+	q.Text = strings.Join(words, " ")
+}
+
+// Terms returns the words of a query worth highlighting: quotes are
+// dropped and negated words (-word) skipped.
+func Terms(text string) []string {
+	var out []string
+	for _, w := range strings.Fields(strings.ReplaceAll(text, `"`, " ")) {
+		if strings.HasPrefix(w, "-") {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	for _, tc := range []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{"no terms", "hello world", nil, "hello world"},
+		{"no match", "hello world", []string{"bye"}, "hello world"},
+		{"case insensitive", "Hello hello HELLO", []string{"hello"}, "<mark>Hello</mark> <mark>hello</mark> <mark>HELLO</mark>"},
+		{"several terms", "lunch at noon?", []string{"noon", "lunch"}, "<mark>lunch</mark> at <mark>noon</mark>?"},
+		{"html escaped", "<b>tom & jerry</b>", []string{"jerry"}, "&lt;b&gt;tom &amp; <mark>jerry</mark>&lt;/b&gt;"},
+		{"regexp metacharacters", "costs $5.00 (approx)", []string{"$5.00", "(approx)"}, "costs <mark>$5.00</mark> <mark>(approx)</mark>"},
+		{"overlapping terms", "football", []string{"foot", "football"}, "<mark>foot</mark>ball"},
+		{"leading ellipsis", long + " needle", []string{"needle"}, "…" + strings.Repeat("a", 59) + " <mark>needle</mark>"},
+		{"trailing ellipsis", "needle " + strings.Repeat("b", 200), []string{"needle"}, "<mark>needle</mark> " + strings.Repeat("b", 173) + "…"},
+		{"match cut at the end", "needle " + strings.Repeat("c", 170) + " needle", []string{"needle"}, "<mark>needle</mark> " + strings.Repeat("c", 170) + " <mark>ne</mark>…"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Snippet(tc.text, tc.terms); got != tc.want {
+				t.Errorf("Snippet(%q, %q)\n got %q\nwant %q", tc.text, tc.terms, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSnippetCutsOnRuneBoundaries(t *testing.T) {
+	// 3-byte runes, so byte offsets around the match fall inside runes
+	text := strings.Repeat("日本", 40) + " 東京 " + strings.Repeat("語", 100)
+	got := Snippet(text, []string{"東京"})
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "<mark>東京</mark>") {
+		t.Errorf("unexpected snippet %q", got)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("snippet cut a rune: %q", got)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		text    string
+		hasFile bool
+	}{
+		{"budget report", "budget report", false},
+		{"has:file budget", "budget", true},
+		{"  budget   HAS:FILE  report ", "budget report", true},
+		{"has:file", "", true},
+		{"", "", false},
+	} {
+		var q Query
+		ParseText(tc.raw, &q)
+		if q.Text != tc.text || q.HasFile != tc.hasFile {
+			t.Errorf("ParseText(%q) = (%q, %v), want (%q, %v)", tc.raw, q.Text, q.HasFile, tc.text, tc.hasFile)
+		}
+	}
+}
+
+func TestTerms(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []string
+	}{
+		{"budget report", []string{"budget", "report"}},
+		{`"quarterly budget" -draft`, []string{"quarterly", "budget"}},
+		{"-only -negated", nil},
+		{"", nil},
+	} {
+		if got := Terms(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Terms(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// snippetContext is how many bytes of text are kept before the first match.
+	snippetContext = 60
+	// snippetLength is the most bytes of text a snippet shows.
+	snippetLength = 180
+)
+
+// Snippet cuts the part of text around the first matching term and wraps
+// every match in <mark></mark>. Everything else is HTML-escaped, so the
+// result can be rendered as HTML.
+func Snippet(text string, terms []string) string {
+	re := termsPattern(terms)
+	start, end := 0, len(text)
+	var locs [][]int
+	if re != nil {
+		locs = re.FindAllStringIndex(text, -1)
+	}
+	if len(locs) > 0 && locs[0][0] > snippetContext {
+		start = runeStart(text, locs[0][0]-snippetContext)
+	}
+	if end-start > snippetLength {
+		end = runeStart(text, start+snippetLength)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, l := range locs {
+		if l[1] <= pos || l[0] >= end {
+			continue
+		}
+		from, to := max(l[0], pos), min(l[1], end)
+		b.WriteString(html.EscapeString(text[pos:from]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[from:to]))
+		b.WriteString("</mark>")
+		pos = to
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func termsPattern(terms []string) *regexp.Regexp {
+	parts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if t != "" {
+			parts = append(parts, regexp.QuoteMeta(t))
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(parts, "|"))
+}
+
+// runeStart moves i back to the start of the rune it falls in.
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,17 @@
+package translate
+
+import "context"
+
+// Fake is a deterministic translator for development and tests: it prefixes
+// the text with the language pair instead of translating it.
+type Fake struct{}
+
+func (Fake) Translate(ctx context.Context, text, from, to string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if from == "" {
+		from = "auto"
+	}
+	return "[translated " + from + "->" + to + "] " + text, nil
+}
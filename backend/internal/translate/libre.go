@@ -0,0 +1,74 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Libre calls a LibreTranslate-compatible API (POST <url>/translate).
+type Libre struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func NewLibre(url, apiKey string, timeout time.Duration) (*Libre, error) {
+	url = strings.TrimSuffix(strings.TrimSpace(url), "/")
+	if url == "" {
+		return nil, errors.New("libretranslate: TRANSLATE_URL is required")
+	}
+	return &Libre{url: url, apiKey: apiKey, client: &http.Client{Timeout: timeout}}, nil
+}
+
+type libreRequest struct {
+	Q      string `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+type libreResponse struct {
+	TranslatedText string `json:"translatedText"`
+	Error          string `json:"error"`
+}
+
+func (l *Libre) Translate(ctx context.Context, text, from, to string) (string, error) {
+	if from == "" {
+		from = "auto"
+	}
+	body, err := json.Marshal(libreRequest{Q: text, Source: from, Target: to, Format: "text", APIKey: l.apiKey})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url+"/translate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("libretranslate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out libreResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return "", fmt.Errorf("libretranslate: bad response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if out.Error == "" {
+			out.Error = resp.Status
+		}
+		return "", fmt.Errorf("libretranslate: %s", out.Error)
+	}
+	return out.TranslatedText, nil
+}
@@ -0,0 +1,103 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLibre(t *testing.T, timeout time.Duration, h http.HandlerFunc) *Libre {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	l, err := NewLibre(srv.URL+"/", "secret", timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestLibreTranslates(t *testing.T) {
+	l := newTestLibre(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/translate" {
+			t.Errorf("got %s %s, want POST /translate", r.Method, r.URL.Path)
+		}
+		var req libreRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		want := libreRequest{Q: "hello", Source: "auto", Target: "es", Format: "text", APIKey: "secret"}
+		if req != want {
+			t.Errorf("request = %+v, want %+v", req, want)
+		}
+		json.NewEncoder(w).Encode(libreResponse{TranslatedText: "hola"})
+	})
+
+	out, err := l.Translate(context.Background(), "hello", "", "es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "hola" {
+		t.Errorf("Translate = %q, want %q", out, "hola")
+	}
+}
+
+func TestLibreHTTPError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		want string
+	}{
+		{"api error", `{"error":"target language not supported"}`, "target language not supported"},
+		{"empty error", `{}`, "500 Internal Server Error"},
+		{"not json", `<html>bad gateway</html>`, "bad response (status 500)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newTestLibre(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(tc.body))
+			})
+			_, err := l.Translate(context.Background(), "hello", "en", "xx")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want one mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLibreTimeout(t *testing.T) {
+	// hang until the test is done with the server
+	hang := func() (http.HandlerFunc, func()) {
+		release := make(chan struct{})
+		return func(w http.ResponseWriter, r *http.Request) { <-release }, func() { close(release) }
+	}
+
+	t.Run("client timeout", func(t *testing.T) {
+		h, release := hang()
+		l := newTestLibre(t, 50*time.Millisecond, h)
+		defer release()
+		start := time.Now()
+		if _, err := l.Translate(context.Background(), "hello", "en", "es"); err == nil {
+			t.Fatal("expected a timeout error")
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("Translate took %v, want about the 50ms timeout", d)
+		}
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		h, release := hang()
+		l := newTestLibre(t, time.Minute, h)
+		defer release()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := l.Translate(ctx, "hello", "en", "es"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+// Package translate turns message text into other languages for delivery.
+package translate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Translator translates text between languages. from may be empty when the
+// source language is unknown.
+type Translator interface {
+	Translate(ctx context.Context, text, from, to string) (string, error)
+}
+
+// New builds the translator selected by kind: "fake" (the default, marks text
+// instead of translating it), "none" (returns text unchanged) or
+// "libretranslate" (any LibreTranslate-compatible HTTP API at url).
+func New(kind, url, apiKey string, timeout time.Duration) (Translator, error) {
+	switch kind {
+	case "", "fake":
+		return Fake{}, nil
+	case "none":
+		return Noop{}, nil
+	case "libretranslate":
+		return NewLibre(url, apiKey, timeout)
+	default:
+		return nil, fmt.Errorf("unknown translator %q", kind)
+	}
+}
+
+// Noop leaves text untouched.
+type Noop struct{}
+
+func (Noop) Translate(_ context.Context, text, _, _ string) (string, error) {
+	return text, nil
+}
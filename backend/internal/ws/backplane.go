@@ -0,0 +1,191 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"realtime-chat/internal/broker"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// envelope kinds exchanged between hub nodes
+const (
+	kindDeliver      = "deliver"       // delivery: push a message to users' devices
+	kindPresence     = "presence"      // presenceEvent: users came online / went offline on a node
+	kindPresenceSync = "presence_sync" // a node started and wants everyone's presence
+	kindGroup        = "group"         // groupEvent: group created or members added
+	kindHeartbeat    = "heartbeat"     // presenceEvent: a node's full list of online users
+)
+
+// delivery is an outgoing message addressed to users rather than sockets.
+// When SrcLang is set, Text is translated into each device's language by the
+// node that owns the device, in the background when not cached yet. Seqs
+// holds each recipient's event sequence number for events that were
+// recorded with emit.
+type delivery struct {
+	To      []string         `json:"to"`
+	SrcLang string           `json:"src_lang,omitempty"`
+	Message OutgoingMessage  `json:"message"`
+	Seqs    map[string]int64 `json:"seqs,omitempty"`
+}
+
+type presenceEvent struct {
+	UserIDs []string `json:"user_ids"`
+	Online  bool     `json:"online"`
+}
+
+type groupEvent struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name,omitempty"`
+	Members []string `json:"members"`
+}
+
+// publish sends an event to every node (including this one) through the broker.
+// Must not be called while holding h.mu.
+func (h *Hub) publish(kind string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("❌ broker: cannot encode %s event: %v", kind, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.broker.Publish(ctx, broker.Envelope{Kind: kind, Origin: h.nodeID, Data: data}); err != nil {
+		log.Printf("❌ broker: publish %s failed: %v", kind, err)
+	}
+}
+
+// emit records ev in every recipient's event stream, so it can be replayed to
+// clients resuming with ?since=, and publishes it for live delivery.
+// Ephemeral events that must not be replayed go through publish directly.
+func (h *Hub) emit(to []string, srcLang string, ev OutgoingMessage) {
+	to = uniqueIDs(to)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	seqs, err := appendEvents(ctx, to, srcLang, ev)
+	if err != nil {
+		log.Printf("⚠️ failed to record %s event: %v", ev.Type, err)
+	}
+	h.publish(kindDeliver, delivery{To: to, SrcLang: srcLang, Message: ev, Seqs: seqs})
+}
+
+// handleEnvelope applies an event published by any node.
+func (h *Hub) handleEnvelope(env broker.Envelope) {
+	switch env.Kind {
+	case kindDeliver:
+		var d delivery
+		if err := json.Unmarshal(env.Data, &d); err != nil {
+			log.Printf("⚠️ broker: bad delivery: %v", err)
+			return
+		}
+		h.deliverLocal(d)
+
+	case kindPresence:
+		if env.Origin == h.nodeID {
+			return // local presence is tracked in h.users
+		}
+		var p presenceEvent
+		if err := json.Unmarshal(env.Data, &p); err != nil {
+			log.Printf("⚠️ broker: bad presence: %v", err)
+			return
+		}
+		h.applyRemotePresence(env.Origin, p)
+
+	case kindHeartbeat:
+		if env.Origin == h.nodeID {
+			return
+		}
+		var p presenceEvent
+		if err := json.Unmarshal(env.Data, &p); err != nil {
+			log.Printf("⚠️ broker: bad heartbeat: %v", err)
+			return
+		}
+		h.applyHeartbeat(env.Origin, p, time.Now())
+
+	case kindPresenceSync:
+		if env.Origin == h.nodeID {
+			return
+		}
+		if ids := h.localUsers(); len(ids) > 0 {
+			h.publish(kindPresence, presenceEvent{UserIDs: ids, Online: true})
+		}
+
+	case kindGroup:
+		var g groupEvent
+		if err := json.Unmarshal(env.Data, &g); err != nil {
+			log.Printf("⚠️ broker: bad group event: %v", err)
+			return
+		}
+		h.applyGroup(g)
+
+	default:
+		log.Printf("⚠️ broker: unknown envelope kind %q", env.Kind)
+	}
+}
+
+func (h *Hub) applyRemotePresence(node string, p presenceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nodeSeen[node] = time.Now()
+	for _, id := range p.UserIDs {
+		nodes := h.remote[id]
+		if p.Online {
+			if nodes == nil {
+				nodes = make(map[string]bool)
+				h.remote[id] = nodes
+			}
+			nodes[node] = true
+			continue
+		}
+		delete(nodes, node)
+		if len(nodes) == 0 {
+			delete(h.remote, id)
+		}
+	}
+}
+
+// deliverLocal pushes a delivery to the recipients' devices connected to this
+// node and records message delivery for the users with at least one device
+// that queued it. Devices still replaying record it once they catch up.
+func (h *Hub) deliverLocal(d delivery) {
+	var reached []string
+	for _, userID := range d.To {
+		queued := false
+		for _, c := range h.GetClients(userID) {
+			out := d.Message
+			h.localize(c, &out, d.SrcLang)
+			out.Lang = c.preferredLang
+			out.Seq = d.Seqs[userID]
+			if c.deliver(out) {
+				queued = true
+			}
+		}
+		if queued && userID != d.Message.FromUser {
+			reached = append(reached, userID)
+		}
+	}
+
+	if d.Message.Type != "message" || len(reached) == 0 {
+		return
+	}
+	if oid, err := primitive.ObjectIDFromHex(d.Message.ID); err == nil {
+		go h.recordDelivery(reached, []primitive.ObjectID{oid})
+	}
+}
+
+// uniqueIDs drops duplicate and empty user IDs, keeping the first occurrence.
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
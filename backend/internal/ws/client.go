@@ -1,10 +1,18 @@
 package ws
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var upgrader = websocket.Upgrader{
@@ -18,33 +26,96 @@ type Client struct {
 	hub           *Hub
 	conn          *websocket.Conn
 	send          chan []byte
+	closed        chan struct{} // closed once the connection is gone
 	userID        string
+	deviceID      string // identifies one of the user's sessions (laptop, phone, ...)
 	preferredLang string
+
+	// session resume: while replaying missed events, live events are buffered
+	// and flushed afterwards so the client sees them in seq order
+	replayMu  sync.Mutex
+	replaying bool
+	buffered  []OutgoingMessage
+	lastSeq   int64
+}
+
+// sendTimeout bounds how long a backlog send waits for a slow client.
+const sendTimeout = 10 * time.Second
+
+var errClientGone = errors.New("client disconnected")
+
+// sendWait queues v like sendJSON, but waits for room in the send buffer
+// instead of dropping it. It fails when the client disconnects or doesn't
+// drain its buffer within sendTimeout. Backlogs (undelivered messages,
+// replay) use it because they can be larger than the buffer.
+func sendWait(ctx context.Context, c *Client, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	timer := time.NewTimer(sendTimeout)
+	defer timer.Stop()
+	select {
+	case c.send <- b:
+		return nil
+	case <-c.closed:
+		return errClientGone
+	case <-timer.C:
+		return context.DeadlineExceeded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// ServeWS upgrades HTTP to WS, verifies token, and registers client
-func ServeWS(hub *Hub, userID, lang string, w http.ResponseWriter, r *http.Request) {
+// newDeviceID returns a random session ID for clients that don't send one.
+func newDeviceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "default"
+	}
+	return hex.EncodeToString(b)
+}
+
+// ServeWS upgrades HTTP to WS, verifies token, and registers client.
+// deviceID may be empty, in which case a fresh session ID is generated.
+// A non-negative since resumes the session: events with a higher seq are
+// replayed from storage before live delivery starts.
+func ServeWS(hub *Hub, userID, deviceID, lang string, since int64, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("upgrade:", err)
 		return
 	}
 
-	log.Printf("✅ WebSocket upgraded for user %s", userID)
+	if deviceID == "" {
+		deviceID = newDeviceID()
+	}
+	log.Printf("✅ WebSocket upgraded for user %s (device %s)", userID, deviceID)
 
 	client := &Client{
 		hub:           hub,
 		conn:          conn,
 		send:          make(chan []byte, 256),
+		closed:        make(chan struct{}),
 		userID:        userID,
+		deviceID:      deviceID,
 		preferredLang: lang,
+		replaying:     since >= 0,
+		lastSeq:       since,
 	}
 
-	hub.AddClient(userID, client)
+	hub.AddClient(client)
 	log.Printf("👥 User %s added to hub", userID)
 
-	// Deliver any undelivered DMs for this user
 	go func() {
+		if since >= 0 {
+			// Resume: replay everything the client missed
+			if err := hub.replayEvents(client, since); err != nil {
+				log.Printf("⚠️ error replaying events to %s: %v", userID, err)
+			}
+			return
+		}
+		// Deliver any undelivered DMs for this user
 		if err := hub.deliverUndelivered(client); err != nil {
 			log.Printf("⚠️ error delivering pending messages to %s: %v", userID, err)
 		}
@@ -55,9 +126,69 @@ func ServeWS(hub *Hub, userID, lang string, w http.ResponseWriter, r *http.Reque
 	go client.readPump()
 }
 
+// deliver queues a live event, holding it back while a replay is running and
+// dropping events the replay already covered. It reports whether the event
+// went into the send buffer; held-back events are accounted for by
+// finishReplay.
+func (c *Client) deliver(out OutgoingMessage) bool {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	if c.replaying {
+		c.buffered = append(c.buffered, out)
+		return false
+	}
+	if out.Seq != 0 && out.Seq <= c.lastSeq {
+		return false
+	}
+	if out.Seq > c.lastSeq {
+		c.lastSeq = out.Seq
+	}
+	ok, _ := queueJSON(c, out)
+	return ok
+}
+
+// finishReplay switches the client to live delivery, flushing buffered events
+// that the replay didn't already send, and records delivery of the buffered
+// messages that were queued.
+func (c *Client) finishReplay(lastReplayed int64) {
+	c.replayMu.Lock()
+	defer c.replayMu.Unlock()
+	if lastReplayed > c.lastSeq {
+		c.lastSeq = lastReplayed
+	}
+	var delivered []primitive.ObjectID
+	for _, out := range c.buffered {
+		if out.Seq != 0 && out.Seq <= c.lastSeq {
+			continue
+		}
+		if out.Seq > c.lastSeq {
+			c.lastSeq = out.Seq
+		}
+		if ok, _ := queueJSON(c, out); !ok || out.Type != "message" || out.FromUser == c.userID {
+			continue
+		}
+		if oid, err := primitive.ObjectIDFromHex(out.ID); err == nil {
+			delivered = append(delivered, oid)
+		}
+	}
+	c.buffered = nil
+	c.replaying = false
+	if len(delivered) > 0 {
+		go c.hub.recordDelivery([]string{c.userID}, delivered)
+	}
+}
+
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.RemoveClient(c.userID)
+		close(c.closed)
+		if c.hub.RemoveClient(c) {
+			log.Printf("👋 User %s went offline", c.userID)
+			go c.hub.markLastSeen(c.userID)
+		}
+		if len(c.hub.GetClients(c.userID)) == 0 {
+			// no device left on this node to keep indicators alive
+			go c.hub.clearTyping(c.userID)
+		}
 		c.conn.Close()
 	}()
 
@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// delete scopes for delete_message
+const (
+	DeleteForMe       = "me"
+	DeleteForEveryone = "everyone"
+)
+
+var (
+	ErrInvalidScope = errors.New("invalid delete scope")
+	ErrNotAllowed   = errors.New("not allowed")
+)
+
+// DeleteMessage removes a message either from the requesting user's view
+// (DeleteForMe) or for all participants (DeleteForEveryone, sender or group
+// admin only). The change is pushed as a message_deleted event.
+func (h *Hub) DeleteMessage(userID, messageID, scope string) error {
+	if scope != DeleteForMe && scope != DeleteForEveryone {
+		return ErrInvalidScope
+	}
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := loadMessage(ctx, oid)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+	audience := h.messageAudience(m)
+	if !contains(audience, userID) {
+		return ErrMessageNotFound
+	}
+
+	ev := OutgoingMessage{
+		Type:           "message_deleted",
+		ID:             messageID,
+		ConversationID: m.ConversationID,
+		GroupID:        m.GroupID,
+		FromUser:       userID,
+		Scope:          scope,
+	}
+
+	if scope == DeleteForMe {
+		if err := hideMessageFor(ctx, oid, userID); err != nil {
+			return err
+		}
+		// only the user's own devices need to know
+		h.emit([]string{userID}, "", ev)
+		return nil
+	}
+
+	if m.Deleted {
+		return nil
+	}
+	if m.SenderID != userID && !h.isGroupAdmin(ctx, m.GroupID, userID) {
+		return ErrNotAllowed
+	}
+	if err := tombstoneMessage(ctx, oid, userID, time.Now().UTC()); err != nil {
+		return err
+	}
+	if err := scrubMessageEvents(ctx, messageID); err != nil {
+		log.Printf("⚠️ failed to scrub stored events for message %s: %v", messageID, err)
+	}
+	h.emit(audience, "", ev)
+	h.unpinDeleted(ctx, m, userID, audience)
+	return nil
+}
+
+// isGroupAdmin reports whether userID administers the group. DMs have no admins.
+func (h *Hub) isGroupAdmin(ctx context.Context, groupID, userID string) bool {
+	if groupID == "" {
+		return false
+	}
+	g, err := loadConversation(ctx, groupID)
+	if err != nil {
+		return false
+	}
+	return g.IsAdmin(userID)
+}
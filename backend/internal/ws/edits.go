@@ -0,0 +1,72 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"realtime-chat/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotMessageSender  = errors.New("only the sender can do this")
+	ErrEditWindowExpired = errors.New("edit window expired")
+	ErrEmptyMessage      = errors.New("message text required")
+	ErrConcurrentEdit    = errors.New("message changed concurrently")
+)
+
+// EditMessage replaces the text of a message the user sent, within the
+// configured edit window. Participants receive a message_edited event,
+// translated for each device like the original message.
+func (h *Hub) EditMessage(userID, messageID, text, lang string, confidence float64) error {
+	if text == "" {
+		return ErrEmptyMessage
+	}
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := loadMessage(ctx, oid)
+	if err != nil || m.Deleted {
+		return ErrMessageNotFound
+	}
+	if m.SenderID != userID {
+		return ErrNotMessageSender
+	}
+	if time.Since(m.CreatedAt) > config.C.EditWindow {
+		return ErrEditWindowExpired
+	}
+	if text == m.Content {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if err := updateMessageContent(ctx, m, text, lang, confidence, now); err != nil {
+		return ErrConcurrentEdit
+	}
+	m.Content, m.ContentLang, m.ContentLangConfidence, m.EditedAt = text, lang, confidence, &now
+
+	ev := messageEvent(m)
+	ev.Type = "message_edited"
+	h.emit(h.messageAudience(m), lang, ev)
+	return nil
+}
+
+// messageAudience lists who should hear about changes to a message: both DM
+// participants, or the group's current members.
+func (h *Hub) messageAudience(m *SavedMessage) []string {
+	if m.GroupID == "" {
+		return []string{m.SenderID, m.RecipientID}
+	}
+	members, err := h.conversationMembers(m.GroupID)
+	if err != nil {
+		return []string{m.SenderID}
+	}
+	return members
+}
@@ -0,0 +1,208 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"realtime-chat/internal/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxReplayEvents caps how many missed events a resuming client receives;
+// anything older has to be reloaded through the history endpoints.
+const maxReplayEvents = 1000
+
+// StoredEvent is one entry of a user's event stream. Seq is monotonic per
+// user, so a reconnecting client can ask for everything after the last seq
+// it saw. Payload is the untranslated OutgoingMessage as JSON.
+type StoredEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    string             `bson:"user_id"`
+	Seq       int64              `bson:"seq"`
+	SrcLang   string             `bson:"src_lang,omitempty"`
+	MessageID string             `bson:"message_id,omitempty"` // message the event is about, if any
+	Payload   []byte             `bson:"payload"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// recentSeqs is how many of its latest allocations a counter remembers; see
+// reserveSeqs.
+const recentSeqs = 64
+
+// reserveSeqs allocates the next sequence number of every user with one bulk
+// write and one read, however many users there are. Each counter remembers
+// the seqs of its last recentSeqs allocations tagged with an allocation ID,
+// so the read finds this allocation's seq even when others ran in between.
+func reserveSeqs(ctx context.Context, userIDs []string) (map[string]int64, error) {
+	if len(userIDs) == 0 {
+		return map[string]int64{}, nil
+	}
+	op := primitive.NewObjectID().Hex()
+	next := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$seq", 0}}, 1}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"seq": next,
+		"recent": bson.M{"$concatArrays": bson.A{
+			bson.M{"$slice": bson.A{bson.M{"$ifNull": bson.A{"$recent", bson.A{}}}, -(recentSeqs - 1)}},
+			bson.A{bson.M{"op": op, "seq": next}},
+		}},
+	}}}}
+
+	keys := make([]string, len(userIDs))
+	writes := make([]mongo.WriteModel, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = "events:" + userID
+		writes[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": keys[i]}).
+			SetUpdate(update).
+			SetUpsert(true)
+	}
+	if _, err := db.Counters().BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return nil, err
+	}
+
+	cur, err := db.Counters().Find(ctx, bson.M{"_id": bson.M{"$in": keys}},
+		options.Find().SetProjection(bson.M{"recent": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID     string `bson:"_id"`
+		Recent []struct {
+			Op  string `bson:"op"`
+			Seq int64  `bson:"seq"`
+		} `bson:"recent"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	seqs := make(map[string]int64, len(userIDs))
+	for _, d := range docs {
+		for _, r := range d.Recent {
+			if r.Op == op {
+				seqs[strings.TrimPrefix(d.ID, "events:")] = r.Seq
+				break
+			}
+		}
+	}
+	if len(seqs) != len(userIDs) {
+		return seqs, fmt.Errorf("allocated seqs for %d of %d users", len(seqs), len(userIDs))
+	}
+	return seqs, nil
+}
+
+// currentSeq returns the last seq allocated to userID, or 0 if none was.
+func currentSeq(ctx context.Context, userID string) (int64, error) {
+	var d struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := db.Counters().FindOne(ctx, bson.M{"_id": "events:" + userID},
+		options.FindOne().SetProjection(bson.M{"seq": 1})).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return d.Seq, err
+}
+
+// appendEvents stores ev in each user's stream and returns the assigned seqs.
+// userIDs must not repeat.
+func appendEvents(ctx context.Context, userIDs []string, srcLang string, ev OutgoingMessage) (map[string]int64, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	seqs, err := reserveSeqs(ctx, userIDs)
+	if err != nil && len(seqs) == 0 {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	docs := make([]interface{}, 0, len(seqs))
+	for _, userID := range userIDs {
+		seq, ok := seqs[userID]
+		if !ok {
+			continue
+		}
+		docs = append(docs, StoredEvent{
+			UserID:    userID,
+			Seq:       seq,
+			SrcLang:   srcLang,
+			MessageID: ev.ID,
+			Payload:   payload,
+			CreatedAt: now,
+		})
+	}
+	if len(docs) == 0 {
+		return seqs, err
+	}
+	if _, insertErr := db.Events().InsertMany(ctx, docs); insertErr != nil {
+		return seqs, insertErr
+	}
+	return seqs, err
+}
+
+// fetchEventsSince returns up to limit of a user's events with seq > since,
+// oldest first.
+func fetchEventsSince(ctx context.Context, userID string, since, limit int64) ([]StoredEvent, error) {
+	opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(limit)
+	cur, err := db.Events().Find(ctx, bson.M{"user_id": userID, "seq": bson.M{"$gt": since}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var out []StoredEvent
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// scrubMessageEvents blanks the content of every stored event about a
+// message that was deleted for everyone, so session replay can't resurrect it.
+func scrubMessageEvents(ctx context.Context, messageID string) error {
+	cur, err := db.Events().Find(ctx, bson.M{"message_id": messageID},
+		options.Find().SetProjection(bson.M{"payload": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var updates []mongo.WriteModel
+	for cur.Next(ctx) {
+		var ev StoredEvent
+		if err := cur.Decode(&ev); err != nil {
+			return err
+		}
+		var out OutgoingMessage
+		if err := json.Unmarshal(ev.Payload, &out); err != nil {
+			continue
+		}
+		out.Text, out.Files = "", nil
+		out.ReplyText = ""
+		out.Deleted = true
+		payload, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": ev.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"payload": payload, "src_lang": ""}}))
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	_, err = db.Events().BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+	return err
+}
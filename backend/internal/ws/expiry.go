@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// expiryInterval is how often each node purges expired messages.
+	expiryInterval = 30 * time.Second
+	expiryBatch    = 200
+	minMessageTTL  = time.Minute
+	maxMessageTTL  = 90 * 24 * time.Hour
+	// uploadDir is where UploadFile stores files served under /uploads/.
+	uploadDir = "./uploads"
+)
+
+var ErrInvalidTTL = errors.New("invalid message ttl")
+
+// SetDisappearing sets how long new messages in a conversation live; 0 turns
+// disappearing messages off. Anyone in a DM may change it, only admins in a
+// group. Members get a disappearing_updated event.
+func (h *Hub) SetDisappearing(userID, conversationID string, ttl time.Duration) error {
+	if ttl != 0 && (ttl < minMessageTTL || ttl > maxMessageTTL) {
+		return ErrInvalidTTL
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conv, err := loadConversation(ctx, conversationID)
+	if err != nil || !conv.IsMember(userID) {
+		return ErrConversationNotFound
+	}
+	if !conv.IsDM() && !conv.IsAdmin(userID) {
+		return ErrNotAllowed
+	}
+	seconds := int64(ttl / time.Second)
+	if err := setMessageTTL(ctx, conv.ID, seconds); err != nil {
+		return err
+	}
+	h.emit(conv.Members, "", OutgoingMessage{
+		Type:           "disappearing_updated",
+		ConversationID: conversationID,
+		FromUser:       userID,
+		MessageTTL:     seconds,
+	})
+	return nil
+}
+
+// messageExpiry returns when a message sent now to the conversation should
+// disappear, or nil if the conversation keeps messages.
+func messageExpiry(conversationID string) *time.Time {
+	if conversationID == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	conv, err := loadConversation(ctx, conversationID)
+	if err != nil || conv.MessageTTL <= 0 {
+		return nil
+	}
+	at := time.Now().UTC().Add(time.Duration(conv.MessageTTL) * time.Second)
+	return &at
+}
+
+// RunExpiry purges expired messages until ctx is done.
+func (h *Hub) RunExpiry(ctx context.Context) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.purgeExpired(ctx)
+		}
+	}
+}
+
+// purgeExpired deletes expired messages along with their uploaded files and
+// tells online participants. Nodes may race on the same message; only the one
+// whose delete succeeds does the rest.
+func (h *Hub) purgeExpired(ctx context.Context) {
+	for ctx.Err() == nil {
+		batchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		n, err := h.purgeExpiredBatch(batchCtx)
+		cancel()
+		if err != nil {
+			log.Printf("⚠️ failed to purge expired messages: %v", err)
+			return
+		}
+		if n < expiryBatch {
+			return
+		}
+	}
+}
+
+func (h *Hub) purgeExpiredBatch(ctx context.Context) (int, error) {
+	msgs, err := fetchExpired(ctx, time.Now().UTC(), expiryBatch)
+	if err != nil {
+		return 0, err
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		deleted, err := deleteMessage(ctx, m.ID)
+		if err != nil {
+			return 0, err
+		}
+		if !deleted {
+			continue
+		}
+		if err := scrubMessageEvents(ctx, m.ID.Hex()); err != nil {
+			log.Printf("⚠️ failed to scrub stored events for message %s: %v", m.ID.Hex(), err)
+		}
+		if convID, err := primitive.ObjectIDFromHex(m.ConversationID); err == nil {
+			_, _ = removePin(ctx, convID, m.ID.Hex())
+		}
+		removeUnusedFiles(ctx, m.Files)
+
+		// online participants only: offline devices never see it again anyway
+		h.publish(kindDeliver, delivery{To: h.messageAudience(m), Message: OutgoingMessage{
+			Type:           "message_expired",
+			ID:             m.ID.Hex(),
+			ConversationID: m.ConversationID,
+			GroupID:        m.GroupID,
+		}})
+	}
+	if len(msgs) > 0 {
+		log.Printf("⌛ Purged %d expired messages", len(msgs))
+	}
+	return len(msgs), nil
+}
+
+// removeUnusedFiles deletes uploaded files no remaining message refers to;
+// a forwarded copy may still share them.
+func removeUnusedFiles(ctx context.Context, urls []string) {
+	for _, url := range urls {
+		_, name, ok := strings.Cut(url, "/uploads/")
+		if !ok || name == "" {
+			continue
+		}
+		inUse, err := fileInUse(ctx, url)
+		if err != nil || inUse {
+			continue
+		}
+		path := filepath.Join(uploadDir, filepath.Base(name))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("⚠️ failed to remove expired upload %s: %v", path, err)
+		}
+	}
+}
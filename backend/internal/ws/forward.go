@@ -0,0 +1,120 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxForwardTargets caps how many conversations one forward_message can reach.
+const maxForwardTargets = 20
+
+var (
+	ErrNoForwardTargets = errors.New("no forward targets")
+	ErrTooManyTargets   = errors.New("too many forward targets")
+	ErrInvalidTarget    = errors.New("invalid forward target")
+)
+
+// ForwardTarget is a conversation a message is forwarded into. DM targets
+// need conversation_id; to_user is derived from it when omitted.
+type ForwardTarget struct {
+	ChatType       string `json:"chat_type"` // "dm" | "group"
+	ToUser         string `json:"to_user,omitempty"`
+	GroupID        string `json:"group_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+// ForwardMessage copies the text and files of a message the user can see into
+// each target conversation, recording where it came from. The stored copies
+// are returned in target order; a target that failed has a nil copy and its
+// error at the same index of errs.
+func (h *Hub) ForwardMessage(userID, messageID string, targets []ForwardTarget) (copies []*SavedMessage, errs []error, err error) {
+	if len(targets) == 0 {
+		return nil, nil, ErrNoForwardTargets
+	}
+	if len(targets) > maxForwardTargets {
+		return nil, nil, ErrTooManyTargets
+	}
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return nil, nil, ErrMessageNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	src, err := loadMessage(ctx, oid)
+	if err != nil || src.Deleted || contains(src.HiddenFor, userID) {
+		return nil, nil, ErrMessageNotFound
+	}
+	if !contains(h.messageAudience(src), userID) {
+		return nil, nil, ErrMessageNotFound
+	}
+
+	// forwarding a forward keeps pointing at the original message
+	from := src.ForwardedFrom
+	if from == nil {
+		from = &models.ForwardedFrom{
+			MessageID:      src.ID.Hex(),
+			SenderID:       src.SenderID,
+			ConversationID: src.ConversationID,
+			GroupID:        src.GroupID,
+		}
+	}
+
+	copies = make([]*SavedMessage, len(targets))
+	errs = make([]error, len(targets))
+	for i, t := range targets {
+		m := &SavedMessage{
+			SenderID:              userID,
+			Content:               src.Content,
+			ContentLang:           src.ContentLang,
+			ContentLangConfidence: src.ContentLangConfidence,
+			Files:                 src.Files,
+			ForwardedFrom:         from,
+		}
+		switch t.ChatType {
+		case "dm":
+			m.ConversationID = t.ConversationID
+			if m.RecipientID, errs[i] = dmPeer(ctx, userID, t.ConversationID, t.ToUser); errs[i] == nil {
+				errs[i] = h.SendDM(m)
+			}
+		case "group":
+			m.GroupID = t.GroupID
+			errs[i] = h.SendToGroup(m)
+		default:
+			errs[i] = ErrInvalidTarget
+		}
+		if errs[i] == nil {
+			copies[i] = m
+		}
+	}
+	return copies, errs, nil
+}
+
+// dmPeer checks that userID belongs to the DM conversation and returns the
+// other participant, which must match toUser when that is given.
+func dmPeer(ctx context.Context, userID, conversationID, toUser string) (string, error) {
+	if conversationID == "" {
+		return "", ErrInvalidTarget
+	}
+	conv, err := loadConversation(ctx, conversationID)
+	if err != nil {
+		return "", ErrConversationNotFound
+	}
+	if !conv.IsDM() || !conv.IsMember(userID) || len(conv.Members) != 2 {
+		return "", ErrInvalidTarget
+	}
+	peer := conv.Members[0]
+	if peer == userID {
+		peer = conv.Members[1]
+	}
+	if toUser != "" && toUser != peer {
+		return "", ErrInvalidTarget
+	}
+	return peer, nil
+}
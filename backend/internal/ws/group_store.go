@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,7 +16,11 @@ type GroupDoc struct {
 	Name      string             `bson:"name"`
 	Members   []string           `bson:"members"`
 	CreatedBy string             `bson:"created_by"`
-	CreatedAt time.Time          `bson:"created_at"`
+	Admins    []string           `bson:"admins,omitempty"` // besides the creator
+	Pins      []models.Pin       `bson:"pins,omitempty"`
+	// MessageTTL makes new messages disappear this many seconds after sending (0 = off)
+	MessageTTL int64     `bson:"message_ttl,omitempty"`
+	CreatedAt  time.Time `bson:"created_at"`
 }
 
 func SaveGroup(ctx context.Context, name string, creator string, members []string) (string, error) {
@@ -47,6 +52,78 @@ func AddMemberToGroupDB(ctx context.Context, groupID, userID string) error {
 	return err
 }
 
+// loadConversation fetches a DM or group conversation document by ID.
+func loadConversation(ctx context.Context, conversationID string) (*GroupDoc, error) {
+	oid, err := primitive.ObjectIDFromHex(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	var g GroupDoc
+	if err := db.Groups().FindOne(ctx, bson.M{"_id": oid}).Decode(&g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// IsMember reports whether userID belongs to the conversation.
+func (g *GroupDoc) IsMember(userID string) bool {
+	return contains(g.Members, userID)
+}
+
+// IsDM reports whether the conversation is a direct message.
+func (g *GroupDoc) IsDM() bool {
+	return g.Name == models.DMName
+}
+
+// Holds reports whether m was sent in this conversation: a group message of
+// this group, or a DM between two of this DM's members.
+func (g *GroupDoc) Holds(m *SavedMessage) bool {
+	if g.IsDM() {
+		return m.GroupID == "" && g.IsMember(m.SenderID) && g.IsMember(m.RecipientID)
+	}
+	return m.GroupID == g.ID.Hex()
+}
+
+// IsAdmin reports whether userID may moderate the group. The creator is
+// always an admin.
+func (g *GroupDoc) IsAdmin(userID string) bool {
+	return g.CreatedBy == userID || contains(g.Admins, userID)
+}
+
+// addPin pins a message on the conversation. It reports false if the message
+// was already pinned.
+func addPin(ctx context.Context, conversationID primitive.ObjectID, pin models.Pin) (bool, error) {
+	res, err := db.Groups().UpdateOne(ctx,
+		bson.M{"_id": conversationID, "pins.message_id": bson.M{"$ne": pin.MessageID}},
+		bson.M{"$push": bson.M{"pins": pin}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// removePin unpins a message. It reports false if the message wasn't pinned.
+func removePin(ctx context.Context, conversationID primitive.ObjectID, messageID string) (bool, error) {
+	res, err := db.Groups().UpdateByID(ctx, conversationID, bson.M{
+		"$pull": bson.M{"pins": bson.M{"message_id": messageID}},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// setMessageTTL changes how long new messages in the conversation live.
+func setMessageTTL(ctx context.Context, conversationID primitive.ObjectID, seconds int64) error {
+	update := bson.M{"$set": bson.M{"message_ttl": seconds}}
+	if seconds == 0 {
+		update = bson.M{"$unset": bson.M{"message_ttl": ""}}
+	}
+	_, err := db.Groups().UpdateByID(ctx, conversationID, update)
+	return err
+}
+
 func LoadAllGroups(ctx context.Context) ([]GroupDoc, error) {
 	cursor, err := db.Groups().Find(ctx, bson.M{})
 	if err != nil {
@@ -0,0 +1,89 @@
+package ws
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// heartbeatInterval is how often a node announces who is online on it.
+	heartbeatInterval = 10 * time.Second
+	// nodeTTL is how long a silent node's users still count as online; a
+	// node that crashed or was killed without saying goodbye drops out after it.
+	nodeTTL = 3 * heartbeatInterval
+)
+
+// RunHeartbeat publishes this node's online users every heartbeatInterval and
+// forgets remote nodes that stopped doing so, until ctx is cancelled.
+func (h *Hub) RunHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.publish(kindHeartbeat, presenceEvent{UserIDs: h.localUsers(), Online: true})
+			h.expireNodes(now.Add(-nodeTTL))
+		}
+	}
+}
+
+// localUsers returns the users with a connection on this node.
+func (h *Hub) localUsers() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.users))
+	for id := range h.users {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// applyHeartbeat replaces what we know about node's users with its snapshot,
+// repairing presence events that were lost on the way.
+func (h *Hub) applyHeartbeat(node string, p presenceEvent, at time.Time) {
+	online := make(map[string]bool, len(p.UserIDs))
+	for _, id := range p.UserIDs {
+		online[id] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nodeSeen[node] = at
+	for id, nodes := range h.remote {
+		if nodes[node] && !online[id] {
+			delete(nodes, node)
+			if len(nodes) == 0 {
+				delete(h.remote, id)
+			}
+		}
+	}
+	for id := range online {
+		nodes := h.remote[id]
+		if nodes == nil {
+			nodes = make(map[string]bool)
+			h.remote[id] = nodes
+		}
+		nodes[node] = true
+	}
+}
+
+// expireNodes drops the users of every remote node last heard from before
+// cutoff.
+func (h *Hub) expireNodes(cutoff time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for node, seen := range h.nodeSeen {
+		if seen.After(cutoff) {
+			continue
+		}
+		delete(h.nodeSeen, node)
+		for id, nodes := range h.remote {
+			delete(nodes, node)
+			if len(nodes) == 0 {
+				delete(h.remote, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func newPresenceHub() *Hub {
+	return &Hub{
+		users:    make(map[string]map[string]*Client),
+		remote:   make(map[string]map[string]bool),
+		nodeSeen: make(map[string]time.Time),
+	}
+}
+
+func TestSilentNodeExpires(t *testing.T) {
+	h := newPresenceHub()
+	start := time.Now()
+	h.applyHeartbeat("node-a", presenceEvent{UserIDs: []string{"u1", "u2"}, Online: true}, start)
+	h.applyHeartbeat("node-b", presenceEvent{UserIDs: []string{"u2"}, Online: true}, start.Add(nodeTTL))
+
+	if !h.IsOnline("u1") || !h.IsOnline("u2") {
+		t.Fatal("users of live nodes should be online")
+	}
+
+	// node-a went silent for longer than nodeTTL; node-b is still fresh
+	h.expireNodes(start.Add(nodeTTL + time.Second).Add(-nodeTTL))
+	if h.IsOnline("u1") {
+		t.Error("u1 was only on the silent node and should be offline")
+	}
+	if !h.IsOnline("u2") {
+		t.Error("u2 is still connected to node-b")
+	}
+}
+
+func TestHeartbeatReplacesSnapshot(t *testing.T) {
+	h := newPresenceHub()
+	// node-a's offline event for u1 was lost on the way
+	h.applyRemotePresence("node-a", presenceEvent{UserIDs: []string{"u1", "u2"}, Online: true})
+	h.applyHeartbeat("node-a", presenceEvent{UserIDs: []string{"u2", "u3"}, Online: true}, time.Now())
+
+	want := map[string]bool{"u1": false, "u2": true, "u3": true}
+	for id, online := range want {
+		if got := h.IsOnline(id); got != online {
+			t.Errorf("IsOnline(%s) = %v, want %v", id, got, online)
+		}
+	}
+}
@@ -3,34 +3,72 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"realtime-chat/internal/broker"
+	"realtime-chat/internal/config"
 	"realtime-chat/internal/db"
 	"realtime-chat/internal/models"
+	"realtime-chat/internal/translate"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrNotGroupMember = errors.New("not a group member")
+	// ErrNotDMConversation: a DM's conversation_id isn't the DM between its
+	// sender and recipient
+	ErrNotDMConversation = errors.New("not the DM conversation of sender and recipient")
+)
+
 type Group struct {
 	ID      string
 	Name    string
 	Members map[string]bool // userID -> in group
 }
 
-// Hub keeps track of online users
+// Hub keeps track of online users. A user is online while at least one of
+// their devices holds an open connection on any node.
+//
+// Everything that must reach users (messages, presence, group changes) is
+// published through the broker; each node then delivers to its own clients.
 type Hub struct {
 	mu     sync.RWMutex
-	users  map[string]*Client // userID -> client
-	groups map[string]*Group  // groupID -> group
+	users  map[string]map[string]*Client // userID -> deviceID -> client (this node)
+	remote map[string]map[string]bool    // userID -> nodeIDs where the user is online
+	groups map[string]*Group             // groupID -> group
+	// nodeSeen is when each remote node was last heard from (see heartbeat.go)
+	nodeSeen map[string]time.Time
+
+	typingMu sync.Mutex
+	typing   map[typingKey]*time.Timer // active typing indicators started on this node
+
+	broker       broker.Broker
+	nodeID       string
+	translator   translate.Translator
+	translations *translationCache
+	// translationPool queues translations that aren't cached yet
+	translationPool *translationPool
 }
 
-func NewHub() *Hub {
+func NewHub(b broker.Broker, tr translate.Translator) *Hub {
 	hub := &Hub{
-		users:  make(map[string]*Client),
-		groups: make(map[string]*Group),
+		users:           make(map[string]map[string]*Client),
+		remote:          make(map[string]map[string]bool),
+		nodeSeen:        make(map[string]time.Time),
+		groups:          make(map[string]*Group),
+		typing:          make(map[typingKey]*time.Timer),
+		broker:          b,
+		nodeID:          newDeviceID(),
+		translator:      tr,
+		translations:    newTranslationCache(translationCacheSize),
+		translationPool: newTranslationPool(config.C.TranslateQueue),
 	}
 
 	// Load all groups from database into memory
@@ -38,146 +76,293 @@ func NewHub() *Hub {
 		log.Printf("⚠️ Failed to load groups from DB: %v", err)
 	}
 
+	if err := b.Subscribe(hub.handleEnvelope); err != nil {
+		log.Fatalf("❌ Failed to subscribe to broker: %v", err)
+	}
+	// ask the other nodes who is online there
+	hub.publish(kindPresenceSync, nil)
+	log.Printf("🛰️ Hub node %s subscribed to broker", hub.nodeID)
+
 	return hub
 }
 
-func (h *Hub) AddClient(userID string, c *Client) {
+// AddClient registers a device connection for its user. A reconnect from the
+// same device replaces (and closes) the stale connection.
+func (h *Hub) AddClient(c *Client) {
 	h.mu.Lock()
-	h.users[userID] = c
+	devices, ok := h.users[c.userID]
+	if !ok {
+		devices = make(map[string]*Client)
+		h.users[c.userID] = devices
+	}
+	old := devices[c.deviceID]
+	devices[c.deviceID] = c
+	first := len(devices) == 1
 	h.mu.Unlock()
+
+	if old != nil && old != c {
+		log.Printf("♻️ Replacing stale connection for user %s device %s", c.userID, c.deviceID)
+		old.conn.Close()
+	}
+	if first {
+		h.publish(kindPresence, presenceEvent{UserIDs: []string{c.userID}, Online: true})
+	}
 }
 
-func (h *Hub) RemoveClient(userID string) {
+// RemoveClient unregisters a device connection. It reports whether the user
+// is now offline everywhere, i.e. this was their last open connection.
+func (h *Hub) RemoveClient(c *Client) bool {
 	h.mu.Lock()
-	delete(h.users, userID)
+	devices, ok := h.users[c.userID]
+	if !ok || devices[c.deviceID] != c {
+		// already replaced by a newer connection from the same device
+		h.mu.Unlock()
+		return false
+	}
+	delete(devices, c.deviceID)
+	if len(devices) > 0 {
+		h.mu.Unlock()
+		return false
+	}
+	delete(h.users, c.userID)
+	elsewhere := len(h.remote[c.userID]) > 0
 	h.mu.Unlock()
+
+	h.publish(kindPresence, presenceEvent{UserIDs: []string{c.userID}, Online: false})
+	return !elsewhere
 }
 
-func (h *Hub) GetClient(userID string) (*Client, bool) {
+// GetClients returns a snapshot of every live connection for a user.
+func (h *Hub) GetClients(userID string) []*Client {
 	h.mu.RLock()
-	c, ok := h.users[userID]
-	h.mu.RUnlock()
-	return c, ok
+	defer h.mu.RUnlock()
+	devices := h.users[userID]
+	out := make([]*Client, 0, len(devices))
+	for _, c := range devices {
+		out = append(out, c)
+	}
+	return out
 }
 
-// send DM with translation hook
-func (h *Hub) SendDM(fromID, toID, conversationID, text, fromLang string, files []string, replyTo, replyText, replySender string) {
-	log.Printf("💬 Processing DM from %s to %s in conversation %s: %s (lang: %s)", fromID, toID, conversationID, text, fromLang)
+// SendDM persists a direct message and publishes it to the recipient's devices.
+// On success m.ID and m.CreatedAt hold the server-assigned values.
+func (h *Hub) SendDM(m *SavedMessage) error {
+	log.Printf("💬 Processing DM from %s to %s in conversation %s: %s (lang: %s)", m.SenderID, m.RecipientID, m.ConversationID, m.Content, m.ContentLang)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	peer, err := dmPeer(ctx, m.SenderID, m.ConversationID, m.RecipientID)
+	cancel()
+	if errors.Is(err, ErrInvalidTarget) {
+		return ErrNotDMConversation
+	}
+	if err != nil {
+		return err
+	}
+	m.RecipientID = peer
 
 	// resolve reply sender to a display name if it's an object id
-	resolvedReplySender := resolveUserDisplayName(replySender)
+	m.ReplySender = resolveUserDisplayName(m.ReplySender)
+
+	var root *SavedMessage
+	if m.ThreadID != "" {
+		var err error
+		if root, err = threadRoot(context.Background(), m); err != nil {
+			return err
+		}
+	}
+
+	m.ExpiresAt = messageExpiry(m.ConversationID)
 
 	// persist original message language
-	// saveDM expects recipientID for DMs
-	err := saveDM(context.Background(), fromID, toID, text, fromLang, files, replyTo, replyText, resolvedReplySender)
-	if err != nil {
+	if err := saveMessage(context.Background(), m); err != nil {
 		log.Printf("❌ Failed to save DM: %v", err)
-	} else {
-		log.Printf("✅ DM saved to database")
+		return err
 	}
+	log.Printf("✅ DM %s saved to database", m.ID.Hex())
 
-	receiver, ok := h.GetClient(toID)
-	if !ok {
-		log.Printf("👻 User %s is offline - message saved for later", toID)
-		return
+	if !h.IsOnline(m.RecipientID) {
+		log.Printf("👻 User %s is offline - message saved for later", m.RecipientID)
 	}
 
-	translated := translate(text, fromLang, receiver.preferredLang)
-	log.Printf("🌐 Translated message: %s -> %s", text, translated)
-
-	out := OutgoingMessage{
-		Type:        "message",
-		ChatType:    "dm",
-		FromUser:    fromID,
-		Text:        translated,
-		ReplyTo:     replyTo,
-		ReplyText:   replyText,
-		ReplySender: resolvedReplySender,
-		Files:       files,
-		Lang:        receiver.preferredLang,
-	}
-
-	b, _ := json.Marshal(out)
-	log.Printf("📤 Sending message to user %s: %s", toID, string(b))
-	receiver.send <- b
-	log.Printf("✅ Message queued for delivery to %s", toID)
+	// every node delivers to its own devices of the recipient, translated per device
+	h.emit([]string{m.RecipientID}, m.ContentLang, messageEvent(m))
+	log.Printf("✅ Message published for delivery to %s", m.RecipientID)
+	if root != nil {
+		h.onThreadReply(root, m)
+	}
+	return nil
 }
 
-// create group in memory
+// create group in memory (on every node) and tell the members about it
 func (h *Hub) CreateGroup(id, name string, members []string) {
+	h.publish(kindGroup, groupEvent{ID: id, Name: name, Members: members})
+	h.emit(members, "", OutgoingMessage{
+		Type:           "group_created",
+		GroupID:        id,
+		ConversationID: id,
+		Text:           "group created",
+	})
+}
+
+// AddMemberToGroup adds the member on every node and notifies all members,
+// including the one who joined.
+func (h *Hub) AddMemberToGroup(groupID, userID string) {
+	h.publish(kindGroup, groupEvent{ID: groupID, Members: []string{userID}})
+
+	// the broker may apply the group event asynchronously, so don't rely on it here
+	members := h.groupMembers(groupID)
+	if !contains(members, userID) {
+		members = append(members, userID)
+	}
+	h.emit(members, "", OutgoingMessage{
+		Type:           "joined_group",
+		GroupID:        groupID,
+		ConversationID: groupID,
+		FromUser:       userID,
+		Text:           "joined group",
+	})
+}
+
+// applyGroup creates the group if this node doesn't know it yet and adds members.
+func (h *Hub) applyGroup(ev groupEvent) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	g := &Group{
-		ID:      id,
-		Name:    name,
-		Members: make(map[string]bool),
+	g, ok := h.groups[ev.ID]
+	if !ok {
+		g = &Group{
+			ID:      ev.ID,
+			Members: make(map[string]bool),
+		}
+		h.groups[ev.ID] = g
+	}
+	if ev.Name != "" {
+		g.Name = ev.Name
 	}
-	for _, m := range members {
+	for _, m := range ev.Members {
 		g.Members[m] = true
 	}
-	h.groups[id] = g
 }
 
-func (h *Hub) AddMemberToGroup(groupID, userID string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if g, ok := h.groups[groupID]; ok {
-		g.Members[userID] = true
+// SendToGroup persists a group message once and publishes it to every member.
+// On success m.ID and m.CreatedAt hold the server-assigned values.
+func (h *Hub) SendToGroup(m *SavedMessage) error {
+	members := h.groupMembers(m.GroupID)
+	if len(members) == 0 {
+		return ErrGroupNotFound
+	}
+	if !contains(members, m.SenderID) {
+		return ErrNotGroupMember
 	}
-}
 
-// broadcast to group
-func (h *Hub) SendToGroup(fromID, groupID, text, fromLang string, files []string, replyTo, replyText, replySender string) {
 	// resolve reply sender to display name
-	resolvedReplySender := resolveUserDisplayName(replySender)
+	m.ReplySender = resolveUserDisplayName(m.ReplySender)
+	m.ConversationID = m.GroupID
+
+	var root *SavedMessage
+	if m.ThreadID != "" {
+		var err error
+		if root, err = threadRoot(context.Background(), m); err != nil {
+			return err
+		}
+	}
+
+	// forwarded text was written for another audience; don't ping this one
+	if m.ForwardedFrom == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		m.Mentions = h.parseMentions(ctx, m.Content, m.SenderID, members)
+		cancel()
+	}
+
+	m.ExpiresAt = messageExpiry(m.ConversationID)
+
+	// track delivery per member; the sender doesn't count
+	m.Recipients = make([]string, 0, len(members))
+	for _, id := range members {
+		if id != m.SenderID {
+			m.Recipients = append(m.Recipients, id)
+		}
+	}
 
 	// persist once
-	_ = saveGroupMsg(context.Background(), fromID, groupID, text, fromLang, files, replyTo, replyText, resolvedReplySender)
+	if err := saveMessage(context.Background(), m); err != nil {
+		log.Printf("❌ Failed to save group message: %v", err)
+		return err
+	}
+
+	// each node sends to its online member devices in their lang;
+	// offline members get it from deliverUndelivered when they reconnect
+	h.emit(members, m.ContentLang, messageEvent(m))
+	h.notifyMentions(m)
+	if root != nil {
+		h.onThreadReply(root, m)
+	}
+	return nil
+}
+
+// messageEvent builds the untranslated "message" event for a stored message.
+func messageEvent(m *SavedMessage) OutgoingMessage {
+	out := OutgoingMessage{
+		Type:           "message",
+		ID:             m.ID.Hex(),
+		ConversationID: m.ConversationID,
+		FromUser:       m.SenderID,
+		GroupID:        m.GroupID,
+		Text:           m.Content,
+		ReplyTo:        m.ReplyTo,
+		ReplyText:      m.ReplyText,
+		ReplySender:    m.ReplySender,
+		ThreadID:       m.ThreadID,
+		ReplyCount:     m.ReplyCount,
+		LastReplyAt:    m.LastReplyAt,
+		Mentions:       m.Mentions,
+		ForwardedFrom:  m.ForwardedFrom,
+		ExpiresAt:      m.ExpiresAt,
+		Files:          m.Files,
+		CreatedAt:      timePtr(m.CreatedAt),
+		EditedAt:       m.EditedAt,
+		Deleted:        m.Deleted,
+		Reactions:      models.SummarizeReactions(m.Reactions),
+	}
+	if m.Poll != nil {
+		out.Poll = m.Poll.View()
+	}
+	if m.GroupID != "" {
+		out.ChatType = "group"
+	} else {
+		out.ChatType = "dm"
+	}
+	return out
+}
 
+// groupMembers snapshots the member IDs of a group known to this node.
+func (h *Hub) groupMembers(groupID string) []string {
 	h.mu.RLock()
+	defer h.mu.RUnlock()
 	g, ok := h.groups[groupID]
-	h.mu.RUnlock()
 	if !ok {
-		return
+		return nil
 	}
-
-	// for each member: if online, send in their lang
+	out := make([]string, 0, len(g.Members))
 	for memberID := range g.Members {
-		h.mu.RLock()
-		receiver, ok := h.users[memberID]
-		h.mu.RUnlock()
-		if !ok {
-			continue // offline, later we’ll save to DB
-		}
-
-		translated := translate(text, fromLang, receiver.preferredLang)
-
-		out := OutgoingMessage{
-			Type:        "message",
-			ChatType:    "group",
-			FromUser:    fromID,
-			GroupID:     groupID,
-			Text:        translated,
-			ReplyTo:     replyTo,
-			ReplyText:   replyText,
-			ReplySender: resolvedReplySender,
-			Lang:        receiver.preferredLang,
-			Files:       files,
-		}
-		b, _ := json.Marshal(out)
-		receiver.send <- b
+		out = append(out, memberID)
 	}
+	return out
 }
 
-// OnlineUserIDs returns a snapshot of currently online user IDs.
+// OnlineUserIDs returns a snapshot of currently online user IDs across all nodes.
 func (h *Hub) OnlineUserIDs() []string {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	ids := make([]string, 0, len(h.users))
+	ids := make([]string, 0, len(h.users)+len(h.remote))
 	for id := range h.users {
 		ids = append(ids, id)
 	}
+	for id := range h.remote {
+		if _, local := h.users[id]; !local {
+			ids = append(ids, id)
+		}
+	}
 	return ids
 }
 
@@ -185,6 +370,9 @@ func (h *Hub) OnlineUserIDs() []string {
 func (h *Hub) IsOnline(userID string) bool {
 	h.mu.RLock()
 	_, ok := h.users[userID]
+	if !ok {
+		ok = len(h.remote[userID]) > 0
+	}
 	h.mu.RUnlock()
 	return ok
 }
@@ -216,43 +404,187 @@ func (h *Hub) loadGroupsFromDB() error {
 	return nil
 }
 
-// deliver undelivered DMs to a connected client
+// markLastSeen records when a user's last connection closed.
+func (h *Hub) markLastSeen(userID string) {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := db.Users().UpdateByID(ctx, oid, bson.M{"$set": bson.M{"last_seen_at": time.Now()}}); err != nil {
+		log.Printf("⚠️ failed to update last_seen_at for %s: %v", userID, err)
+	}
+}
+
+// undeliveredPage is how many pending messages are loaded at a time.
+const undeliveredPage = 200
+
+// deliver undelivered DMs and group messages to a connected client, a page at
+// a time. Sends wait for the client to drain its buffer, and only messages
+// actually queued to it are recorded as delivered; the rest stay pending for
+// the next connection.
 func (h *Hub) deliverUndelivered(client *Client) error {
-	msgs, err := fetchUndeliveredDMs(context.Background(), client.userID)
+	ctx := context.Background()
+	var after *SavedMessage
+	for {
+		msgs, err := fetchUndelivered(ctx, client.userID, after, undeliveredPage)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(msgs))
+		var sendErr error
+		for i := range msgs {
+			m := &msgs[i]
+			// resolve reply sender name for presentation
+			m.ReplySender = resolveUserDisplayName(m.ReplySender)
+
+			out := messageEvent(m)
+			// translate content to client's preferred language
+			h.localizeStored(client, &out, m)
+			out.Lang = client.preferredLang
+			if sendErr = sendWait(ctx, client, out); sendErr != nil {
+				break
+			}
+			ids = append(ids, m.ID)
+		}
+
+		h.recordDelivery([]string{client.userID}, ids)
+		if sendErr != nil {
+			return fmt.Errorf("delivered %d of a page of %d: %w", len(ids), len(msgs), sendErr)
+		}
+		if len(msgs) < undeliveredPage {
+			return nil
+		}
+		after = &msgs[len(msgs)-1]
+	}
+}
+
+// recordDelivery marks messages as received by userIDs and pushes the new
+// "delivered to N of M" counts to each message's sender.
+func (h *Hub) recordDelivery(userIDs []string, ids []primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	counts, err := markDelivered(ctx, userIDs, ids)
 	if err != nil {
+		log.Printf("⚠️ failed to mark messages delivered for users %v: %v", userIDs, err)
+		return
+	}
+	for _, c := range counts {
+		out := OutgoingMessage{
+			Type:           "delivery_update",
+			ID:             c.ID.Hex(),
+			ConversationID: c.ConversationID,
+			GroupID:        c.GroupID,
+			DeliveredCount: c.Delivered,
+			RecipientCount: c.Total,
+		}
+		if c.GroupID != "" {
+			out.ChatType = "group"
+		} else {
+			out.ChatType = "dm"
+		}
+		h.emit([]string{c.SenderID}, "", out)
+	}
+}
+
+// replayEvents sends the client every stored event after since, then a
+// sync_complete marker. Sends wait for the client to drain its buffer, so
+// nothing is skipped silently. If more than maxReplayEvents were missed, the
+// client gets resync_required instead, with Seq the last event it did
+// receive, so it can reconnect with since=Seq to continue. If the stored
+// events don't cover everything up to the user's current seq (they expired,
+// or were never written), resync_required carries the current seq, and
+// undelivered messages are sent as on a fresh connection.
+func (h *Hub) replayEvents(c *Client, since int64) error {
+	ctx := context.Background()
+	// read the head first: events stored meanwhile only come after it
+	head, err := currentSeq(ctx, c.userID)
+	if err != nil {
+		c.finishReplay(since)
 		return err
 	}
-	if len(msgs) == 0 {
-		return nil
+	events, err := fetchEventsSince(ctx, c.userID, since, maxReplayEvents+1)
+	if err != nil {
+		c.finishReplay(since)
+		return err
+	}
+	overflow := len(events) > maxReplayEvents
+	if overflow {
+		events = events[:maxReplayEvents]
+	}
+
+	// the stored events must run from since+1 without holes, up to head
+	gap := false
+	prev := since
+	for _, ev := range events {
+		if ev.Seq != prev+1 {
+			gap = true
+		}
+		prev = ev.Seq
+	}
+	if !overflow && prev < head {
+		gap = true
 	}
 
-	var ids []interface{}
-	for _, m := range msgs {
-		// translate content to client's preferred language
-		translated := translate(m.Content, m.ContentLang, client.preferredLang)
-		// resolve reply sender name for presentation
-		resolvedReplySender := resolveUserDisplayName(m.ReplySender)
+	last := since
+	var delivered []primitive.ObjectID
+	defer func() {
+		if len(delivered) > 0 {
+			h.recordDelivery([]string{c.userID}, delivered)
+		}
+	}()
 
-		out := OutgoingMessage{
-			Type:        "message",
-			ChatType:    "dm",
-			FromUser:    m.SenderID,
-			Text:        translated,
-			ReplyTo:     m.ReplyTo,
-			ReplyText:   m.ReplyText,
-			ReplySender: resolvedReplySender,
-			Files:       m.Files,
-			Lang:        client.preferredLang,
+	for _, ev := range events {
+		var out OutgoingMessage
+		if err := json.Unmarshal(ev.Payload, &out); err != nil {
+			log.Printf("⚠️ skipping bad stored event %d for %s: %v", ev.Seq, c.userID, err)
+			continue
+		}
+		h.localize(c, &out, ev.SrcLang)
+		out.Lang = c.preferredLang
+		out.Seq = ev.Seq
+		if err := sendWait(ctx, c, out); err != nil {
+			// the client only saw events up to last
+			c.finishReplay(last)
+			return err
+		}
+		last = ev.Seq
+
+		if out.Type == "message" && out.FromUser != c.userID {
+			if oid, err := primitive.ObjectIDFromHex(out.ID); err == nil {
+				delivered = append(delivered, oid)
+			}
 		}
-		b, _ := json.Marshal(out)
-		client.send <- b
-		ids = append(ids, m.ID)
 	}
 
-	// mark delivered
-	if err := markMessagesDelivered(context.Background(), ids); err != nil {
-		log.Printf("⚠️ failed to mark messages delivered for user %s: %v", client.userID, err)
+	marker := OutgoingMessage{Type: "sync_complete", Seq: last, Lang: c.preferredLang}
+	switch {
+	case overflow:
+		marker.Type = "resync_required"
+	case gap:
+		// nothing more to replay: skip the client past the hole
+		marker.Type = "resync_required"
+		if head > last {
+			marker.Seq = head
+			last = head
+		}
+	}
+	if err := sendWait(ctx, c, marker); err != nil {
+		c.finishReplay(last)
+		return err
+	}
+	c.finishReplay(last)
+	if gap && !overflow {
+		if err := h.deliverUndelivered(c); err != nil {
+			return err
+		}
 	}
+	log.Printf("🔁 Replayed %d event(s) to user %s (device %s) since seq %d", len(events), c.userID, c.deviceID, since)
 	return nil
 }
 
@@ -280,3 +612,19 @@ func resolveUserDisplayName(identifier string) string {
 	// Not an ObjectID or lookup failed — assume it's already a name
 	return identifier
 }
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+
+	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mentionPattern matches @handle tokens that aren't part of a word, so
+// e-mail addresses in a message don't count as mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.\-]+)`)
+
+// parseMentions resolves @user, @all and @here in a group message against
+// the group's members. @user matches a member's name or display name with
+// spaces removed, the local part of their e-mail, or their user ID. The
+// sender is never mentioned.
+func (h *Hub) parseMentions(ctx context.Context, text, senderID string, members []string) []string {
+	var handles []string
+	all, here := false, false
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		handle := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		switch handle {
+		case "":
+		case "all":
+			all = true
+		case "here":
+			here = true
+		default:
+			handles = append(handles, handle)
+		}
+	}
+
+	var out []string
+	add := func(id string) {
+		if id != senderID && !contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	for _, id := range members {
+		if all || (here && h.IsOnline(id)) {
+			add(id)
+		}
+	}
+	if len(handles) == 0 || all {
+		return out
+	}
+
+	users, err := loadMentionCandidates(ctx, members)
+	if err != nil {
+		log.Printf("⚠️ failed to resolve mentions: %v", err)
+		return out
+	}
+	for _, u := range users {
+		for _, handle := range handles {
+			if mentionHandleMatches(u, handle) {
+				add(u.ID)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func loadMentionCandidates(ctx context.Context, members []string) ([]models.User, error) {
+	oids := make([]primitive.ObjectID, 0, len(members))
+	for _, id := range members {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	cur, err := db.Users().Find(ctx, bson.M{"_id": bson.M{"$in": oids}},
+		options.Find().SetProjection(bson.M{"name": 1, "display_name": 1, "email": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	err = cur.All(ctx, &users)
+	return users, err
+}
+
+func mentionHandleMatches(u models.User, handle string) bool {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), ""))
+	}
+	local, _, _ := strings.Cut(u.Email, "@")
+	for _, candidate := range []string{u.ID, normalize(u.Name), normalize(u.DisplayName), strings.ToLower(local)} {
+		if candidate != "" && candidate == handle {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyMentions sends a mention event to every mentioned member. It is a
+// separate event from "message" so clients can surface it even for
+// conversations whose notifications the user silenced.
+func (h *Hub) notifyMentions(m *SavedMessage) {
+	if len(m.Mentions) == 0 {
+		return
+	}
+	ev := messageEvent(m)
+	ev.Type = "mention"
+	h.emit(m.Mentions, m.ContentLang, ev)
+}
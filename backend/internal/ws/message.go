@@ -3,12 +3,17 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"strings"
+	"time"
+
+	"realtime-chat/internal/langdetect"
+	"realtime-chat/internal/models"
 )
 
 type IncomingMessage struct {
-	Type           string   `json:"type"`                      // "send_message" | "create_group" | "join_group"
+	Type           string   `json:"type"`                      // "send_message" | "create_group" | "join_group" | "mark_read" | "typing_start" | "typing_stop" | "edit_message" | "delete_message" | "add_reaction" | "remove_reaction" | "pin_message" | "unpin_message" | "forward_message" | "schedule_message" | "set_disappearing" | "vote" | "close_poll"
 	ChatType       string   `json:"chat_type,omitempty"`       // "dm" | "group"   (only for send_message)
 	ToUser         string   `json:"to_user,omitempty"`         // for DM
 	GroupID        string   `json:"group_id,omitempty"`        // for group ops & group messages
@@ -22,21 +27,66 @@ type IncomingMessage struct {
 	Members     []string `json:"members,omitempty"` // for create_group
 	Name        string   `json:"name,omitempty"`    // for create_group
 	SourceLang  string   `json:"source_lang,omitempty"`
+	Nonce       string   `json:"nonce,omitempty"`      // client-generated, echoed back in message_ack
+	MessageID   string   `json:"message_id,omitempty"` // target message for mark_read / edit_message / delete_message
+	Scope       string   `json:"scope,omitempty"`      // delete_message: "me" | "everyone"
+	Emoji       string   `json:"emoji,omitempty"`      // add_reaction / remove_reaction
+	ThreadID    string   `json:"thread_id,omitempty"`  // send_message: root message of the thread to reply in
+	// Targets lists the conversations for forward_message
+	Targets []ForwardTarget `json:"targets,omitempty"`
+	SendAt  *time.Time      `json:"send_at,omitempty"` // schedule_message: when to send
+	// MessageTTL is the disappearing-message timer in seconds (set_disappearing, 0 = off)
+	MessageTTL int64 `json:"message_ttl,omitempty"`
+	// Poll makes a group send_message a poll; Choices are option indexes for vote
+	Poll    *models.Poll `json:"poll,omitempty"`
+	Choices []int        `json:"choices,omitempty"`
 }
 
 type OutgoingMessage struct {
-	Type     string   `json:"type"`                // "message" | "group_created" | "joined_group" | "error"
-	ChatType string   `json:"chat_type,omitempty"` // "dm" | "group" (for delivered messages)
-	FromUser string   `json:"from_user,omitempty"` // sender
-	GroupID  string   `json:"group_id,omitempty"`  // target group
-	Text     string   `json:"text,omitempty"`      // delivered text (possibly translated)
-	Files    []string `json:"files,omitempty"`     // file URLs
+	Type           string     `json:"type"`                      // "message" | "message_ack" | "delivery_update" | "message_edited" | "message_deleted" | "reaction_updated" | "thread_updated" | "thread_reply" | "message_pinned" | "message_unpinned" | "mention" | "message_scheduled" | "disappearing_updated" | "message_expired" | "poll_updated" | "message_translated" | "scheduled_message_sent" | "scheduled_message_failed" | "read_receipt" | "typing_start" | "typing_stop" | "group_created" | "joined_group" | "sync_complete" | "resync_required" | "error"
+	Seq            int64      `json:"seq,omitempty"`             // per-user event sequence number (replayable events only)
+	ID             string     `json:"id,omitempty"`              // persisted message ID
+	Nonce          string     `json:"nonce,omitempty"`           // client nonce (message_ack / error)
+	ChatType       string     `json:"chat_type,omitempty"`       // "dm" | "group" (for delivered messages)
+	ConversationID string     `json:"conversation_id,omitempty"` // DM conversation or group ID
+	FromUser       string     `json:"from_user,omitempty"`       // sender
+	GroupID        string     `json:"group_id,omitempty"`        // target group
+	Text           string     `json:"text,omitempty"`            // delivered text (possibly translated)
+	Files          []string   `json:"files,omitempty"`           // file URLs
+	CreatedAt      *time.Time `json:"created_at,omitempty"`      // server timestamp
+	EditedAt       *time.Time `json:"edited_at,omitempty"`       // set once a message was edited
+	Deleted        bool       `json:"deleted,omitempty"`         // tombstone: content removed for everyone
+	Scope          string     `json:"scope,omitempty"`           // message_deleted: "me" | "everyone"
+	Emoji          string     `json:"emoji,omitempty"`           // reaction_updated: emoji that changed
+	// Reactions is the full reaction summary of the message (reaction_updated)
+	Reactions      []models.ReactionSummary `json:"reactions,omitempty"`
+	ReadAt         *time.Time               `json:"read_at,omitempty"`         // read_receipt: when FromUser read up to ID
+	DeliveredCount int                      `json:"delivered_count,omitempty"` // delivery_update: recipients reached
+	RecipientCount int                      `json:"recipient_count,omitempty"` // delivery_update: total recipients
 	// Reply metadata to show quoted message in client
 	ReplyTo     string `json:"reply_to,omitempty"`
 	ReplyText   string `json:"reply_text,omitempty"`
 	ReplySender string `json:"reply_sender,omitempty"`
-	Lang        string `json:"lang,omitempty"`  // recipient language
-	Error       string `json:"error,omitempty"` // error text (when Type="error")
+	// Thread metadata: ThreadID on replies, counts on thread roots
+	ThreadID    string     `json:"thread_id,omitempty"`
+	ReplyCount  int        `json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+	Mentions    []string   `json:"mentions,omitempty"` // user IDs mentioned in a group message
+	// ForwardedFrom is the original message of a forwarded copy
+	ForwardedFrom *models.ForwardedFrom `json:"forwarded_from,omitempty"`
+	ScheduledID   string                `json:"scheduled_id,omitempty"` // scheduled message the event is about
+	SendAt        *time.Time            `json:"send_at,omitempty"`      // message_scheduled: due time
+	ExpiresAt     *time.Time            `json:"expires_at,omitempty"`   // disappearing messages: when it will be purged
+	MessageTTL    int64                 `json:"message_ttl,omitempty"`  // disappearing_updated: new timer in seconds (0 = off)
+	Poll          *models.Poll          `json:"poll,omitempty"`         // poll messages and poll_updated: question, options and results
+	Lang          string                `json:"lang,omitempty"`         // recipient language
+	Error         string                `json:"error,omitempty"`        // error text (when Type="error")
+	// TranslationPending marks text sent in the original language while its
+	// translation runs; a message_translated event with the same ID follows.
+	TranslationPending bool `json:"translation_pending,omitempty"`
+	// TranslationFailed is set on message_translated when no translation
+	// could be made; the original text stands.
+	TranslationFailed bool `json:"translation_failed,omitempty"`
 }
 
 // route incoming messages from a client
@@ -66,11 +116,18 @@ func handleIncoming(h *Hub, sender *Client, raw []byte) {
 				_ = sendError(sender, "conversation_id_required")
 				return
 			}
-			srcLang := msg.SourceLang
-			if srcLang == "" {
-				srcLang = sender.preferredLang
+			if msg.Poll != nil {
+				_ = sendNonceError(sender, msg.Nonce, "polls_are_group_only")
+				return
 			}
-			h.SendDM(sender.userID, msg.ToUser, msg.ConversationID, msg.Text, srcLang, msg.Files, msg.ReplyTo, msg.ReplyText, msg.ReplySender)
+			m := newSavedMessage(sender, msg)
+			m.RecipientID = msg.ToUser
+			m.ConversationID = msg.ConversationID
+			if err := h.SendDM(m); err != nil {
+				_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+				return
+			}
+			_ = sendAck(sender, msg.Nonce, m)
 			return
 		}
 
@@ -79,11 +136,25 @@ func handleIncoming(h *Hub, sender *Client, raw []byte) {
 				_ = sendError(sender, "group_id_required_for_group_message")
 				return
 			}
-			srcLang := msg.SourceLang
-			if srcLang == "" {
-				srcLang = sender.preferredLang
+			m := newSavedMessage(sender, msg)
+			m.GroupID = msg.GroupID
+			if msg.Poll != nil {
+				poll, err := newPoll(msg.Poll)
+				if err != nil {
+					_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+					return
+				}
+				m.Poll = poll
+				if strings.TrimSpace(m.Content) == "" {
+					m.Content = poll.Question
+					m.ContentLang, m.ContentLangConfidence = sourceLanguage(sender, msg.SourceLang, m.Content)
+				}
+			}
+			if err := h.SendToGroup(m); err != nil {
+				_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+				return
 			}
-			h.SendToGroup(sender.userID, msg.GroupID, msg.Text, srcLang, msg.Files, msg.ReplyTo, msg.ReplyText, msg.ReplySender)
+			_ = sendAck(sender, msg.Nonce, m)
 			return
 		}
 
@@ -105,18 +176,9 @@ func handleIncoming(h *Hub, sender *Client, raw []byte) {
 			return
 		}
 
-		// update in-memory
+		// update in-memory and notify members (creator included)
 		h.CreateGroup(groupID, name, append(msg.Members, sender.userID))
 
-		// ack creator
-		ack := OutgoingMessage{
-			Type:    "group_created",
-			GroupID: groupID,
-			Text:    "group created",
-			Lang:    sender.preferredLang,
-		}
-		_ = sendJSON(sender, ack)
-
 	// 3) JOIN GROUP
 	case "join_group":
 		if strings.TrimSpace(msg.GroupID) == "" {
@@ -130,13 +192,153 @@ func handleIncoming(h *Hub, sender *Client, raw []byte) {
 		}
 		h.AddMemberToGroup(msg.GroupID, sender.userID)
 
-		ack := OutgoingMessage{
-			Type:    "joined_group",
-			GroupID: msg.GroupID,
-			Text:    "joined group",
-			Lang:    sender.preferredLang,
+	// 4) MARK READ (everything up to message_id in conversation_id)
+	case "mark_read":
+		if strings.TrimSpace(msg.ConversationID) == "" || strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "conversation_id_and_message_id_required")
+			return
+		}
+		if err := h.MarkRead(sender.userID, msg.ConversationID, msg.MessageID); err != nil {
+			log.Println("ws: mark_read error:", err)
+			_ = sendError(sender, sendErrorCode(err))
+		}
+
+	// 5) TYPING INDICATORS (relayed, never persisted)
+	case "typing_start", "typing_stop":
+		if strings.TrimSpace(msg.ConversationID) == "" {
+			_ = sendError(sender, "conversation_id_required")
+			return
+		}
+		if err := h.SetTyping(sender.userID, msg.ConversationID, msg.Type == "typing_start"); err != nil {
+			_ = sendError(sender, sendErrorCode(err))
+		}
+
+	// 6) EDIT MESSAGE (sender only, within the edit window)
+	case "edit_message":
+		if strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "message_id_required")
+			return
+		}
+		text := strings.TrimSpace(msg.Text)
+		lang, confidence := sourceLanguage(sender, msg.SourceLang, text)
+		if err := h.EditMessage(sender.userID, msg.MessageID, text, lang, confidence); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+		}
+
+	// 7) DELETE MESSAGE (for me, or for everyone by sender / group admin)
+	case "delete_message":
+		if strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "message_id_required")
+			return
+		}
+		if err := h.DeleteMessage(sender.userID, msg.MessageID, strings.TrimSpace(msg.Scope)); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+		}
+
+	// 8) REACTIONS
+	case "add_reaction", "remove_reaction":
+		if strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "message_id_required")
+			return
+		}
+		if err := h.React(sender.userID, msg.MessageID, strings.TrimSpace(msg.Emoji), msg.Type == "add_reaction"); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+		}
+
+	// 9) PINS (anyone in a DM, admins in groups)
+	case "pin_message", "unpin_message":
+		if strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "message_id_required")
+			return
+		}
+		if err := h.PinMessage(sender.userID, msg.MessageID, msg.Type == "pin_message"); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+		}
+
+	// 10) FORWARD (copy a visible message into other conversations)
+	case "forward_message":
+		if strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "message_id_required")
+			return
+		}
+		copies, errs, err := h.ForwardMessage(sender.userID, msg.MessageID, msg.Targets)
+		if err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+			return
+		}
+		// one ack or error per target, in target order
+		for i, m := range copies {
+			if errs[i] != nil {
+				_ = sendNonceError(sender, msg.Nonce, sendErrorCode(errs[i]))
+				continue
+			}
+			_ = sendAck(sender, msg.Nonce, m)
+		}
+
+	// 11) SCHEDULE (stored now, sent by the scheduler at send_at)
+	case "schedule_message":
+		if msg.SendAt == nil {
+			_ = sendError(sender, "send_at_required")
+			return
+		}
+		lang, confidence := sourceLanguage(sender, msg.SourceLang, msg.Text)
+		s := &ScheduledMessage{
+			SenderID:       sender.userID,
+			ChatType:       strings.TrimSpace(msg.ChatType),
+			RecipientID:    msg.ToUser,
+			GroupID:        msg.GroupID,
+			ConversationID: msg.ConversationID,
+			Content:        msg.Text,
+			ContentLang:    lang,
+			LangConfidence: confidence,
+			Files:          msg.Files,
+			ThreadID:       strings.TrimSpace(msg.ThreadID),
+			SendAt:         *msg.SendAt,
+		}
+		if err := h.ScheduleMessage(s); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+			return
+		}
+		_ = sendJSON(sender, OutgoingMessage{
+			Type:           "message_scheduled",
+			Nonce:          msg.Nonce,
+			ScheduledID:    s.ID.Hex(),
+			ChatType:       s.ChatType,
+			ConversationID: s.ConversationID,
+			GroupID:        s.GroupID,
+			SendAt:         &s.SendAt,
+			Lang:           sender.preferredLang,
+		})
+
+	// 12) DISAPPEARING MESSAGES (per-conversation timer)
+	case "set_disappearing":
+		if strings.TrimSpace(msg.ConversationID) == "" {
+			_ = sendError(sender, "conversation_id_required")
+			return
+		}
+		ttl := time.Duration(msg.MessageTTL) * time.Second
+		if err := h.SetDisappearing(sender.userID, msg.ConversationID, ttl); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+		}
+
+	// 13) POLLS
+	case "vote":
+		if strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "message_id_required")
+			return
+		}
+		if err := h.Vote(sender.userID, msg.MessageID, msg.Choices); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
+		}
+
+	case "close_poll":
+		if strings.TrimSpace(msg.MessageID) == "" {
+			_ = sendError(sender, "message_id_required")
+			return
+		}
+		if err := h.ClosePoll(sender.userID, msg.MessageID); err != nil {
+			_ = sendNonceError(sender, msg.Nonce, sendErrorCode(err))
 		}
-		_ = sendJSON(sender, ack)
 
 	// UNKNOWN TYPE
 	default:
@@ -146,22 +348,139 @@ func handleIncoming(h *Hub, sender *Client, raw []byte) {
 
 // helpers
 
+// newSavedMessage copies the fields shared by DMs and group messages.
+func newSavedMessage(sender *Client, msg IncomingMessage) *SavedMessage {
+	lang, confidence := sourceLanguage(sender, msg.SourceLang, msg.Text)
+	return &SavedMessage{
+		SenderID:              sender.userID,
+		Content:               msg.Text,
+		ReplyTo:               msg.ReplyTo,
+		ReplyText:             msg.ReplyText,
+		ReplySender:           msg.ReplySender,
+		ContentLang:           lang,
+		ContentLangConfidence: confidence,
+		Files:                 msg.Files,
+		ThreadID:              strings.TrimSpace(msg.ThreadID),
+	}
+}
+
+// sourceLanguage picks the language of text: the source_lang the client
+// declared, else the detected language, else the sender's own language when
+// the text is too short or ambiguous to tell.
+func sourceLanguage(sender *Client, declared, text string) (string, float64) {
+	if declared != "" {
+		return declared, 1
+	}
+	r := langdetect.Detect(text)
+	if r.Lang == "" || r.Confidence < langdetect.MinConfidence {
+		return sender.preferredLang, r.Confidence
+	}
+	return r.Lang, r.Confidence
+}
+
+// sendAck confirms to the sending device that its message was persisted.
+func sendAck(c *Client, nonce string, m *SavedMessage) error {
+	ev := messageEvent(m)
+	return sendJSON(c, OutgoingMessage{
+		Type:           "message_ack",
+		ID:             ev.ID,
+		Nonce:          nonce,
+		ChatType:       ev.ChatType,
+		ConversationID: ev.ConversationID,
+		GroupID:        ev.GroupID,
+		ThreadID:       ev.ThreadID,
+		CreatedAt:      ev.CreatedAt,
+		Lang:           c.preferredLang,
+	})
+}
+
+func sendErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrGroupNotFound):
+		return "group_not_found"
+	case errors.Is(err, ErrNotGroupMember):
+		return "not_a_group_member"
+	case errors.Is(err, ErrConversationNotFound):
+		return "conversation_not_found"
+	case errors.Is(err, ErrNotDMConversation):
+		return "invalid_conversation"
+	case errors.Is(err, ErrMessageNotFound):
+		return "message_not_found"
+	case errors.Is(err, ErrNotMessageSender):
+		return "not_message_sender"
+	case errors.Is(err, ErrEditWindowExpired):
+		return "edit_window_expired"
+	case errors.Is(err, ErrEmptyMessage):
+		return "text_required"
+	case errors.Is(err, ErrConcurrentEdit):
+		return "concurrent_edit"
+	case errors.Is(err, ErrInvalidScope):
+		return "invalid_scope"
+	case errors.Is(err, ErrNotAllowed):
+		return "not_allowed"
+	case errors.Is(err, ErrInvalidEmoji):
+		return "invalid_emoji"
+	case errors.Is(err, ErrTooManyReactions):
+		return "too_many_reactions"
+	case errors.Is(err, ErrInvalidThread):
+		return "invalid_thread"
+	case errors.Is(err, ErrTooManyPins):
+		return "too_many_pins"
+	case errors.Is(err, ErrNoForwardTargets):
+		return "targets_required"
+	case errors.Is(err, ErrTooManyTargets):
+		return "too_many_targets"
+	case errors.Is(err, ErrInvalidTarget):
+		return "invalid_target"
+	case errors.Is(err, ErrInvalidSendTime):
+		return "invalid_send_at"
+	case errors.Is(err, ErrScheduledNotFound):
+		return "scheduled_message_not_found"
+	case errors.Is(err, ErrInvalidTTL):
+		return "invalid_message_ttl"
+	case errors.Is(err, ErrInvalidPoll):
+		return "invalid_poll"
+	case errors.Is(err, ErrNotAPoll):
+		return "not_a_poll"
+	case errors.Is(err, ErrPollClosed):
+		return "poll_closed"
+	case errors.Is(err, ErrInvalidVote):
+		return "invalid_vote"
+	default:
+		return "db_error_sending_message"
+	}
+}
+
 func sendJSON(c *Client, v any) error {
+	_, err := queueJSON(c, v)
+	return err
+}
+
+// queueJSON is sendJSON reporting whether v made it into the send buffer;
+// it is dropped when the buffer is full.
+func queueJSON(c *Client, v any) (bool, error) {
 	b, err := json.Marshal(v)
 	if err != nil {
-		return err
+		return false, err
 	}
 	select {
 	case c.send <- b:
+		return true, nil
 	default:
 		// client backpressure / closed
+		return false, nil
 	}
-	return nil
 }
 
 func sendError(c *Client, msg string) error {
+	return sendNonceError(c, "", msg)
+}
+
+// sendNonceError reports a failed request, echoing the client's nonce if any.
+func sendNonceError(c *Client, nonce, msg string) error {
 	return sendJSON(c, OutgoingMessage{
 		Type:  "error",
+		Nonce: nonce,
 		Error: msg,
 		Lang:  c.preferredLang,
 	})
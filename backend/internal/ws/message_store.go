@@ -2,19 +2,25 @@ package ws
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SavedMessage struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	SenderID    string             `bson:"sender_id"`
-	RecipientID string             `bson:"recipient_id,omitempty"` // DM
-	GroupID     string             `bson:"group_id,omitempty"`     // Group
-	Content     string             `bson:"content"`
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	SenderID       string             `bson:"sender_id"`
+	RecipientID    string             `bson:"recipient_id,omitempty"`    // DM
+	GroupID        string             `bson:"group_id,omitempty"`        // Group
+	ConversationID string             `bson:"conversation_id,omitempty"` // DM conversation doc, or the group ID
+	Content        string             `bson:"content"`
 	// Reply metadata
 	ReplyTo     string    `bson:"reply_to,omitempty"`
 	ReplyText   string    `bson:"reply_text,omitempty"`
@@ -22,44 +28,369 @@ type SavedMessage struct {
 	ContentLang string    `bson:"content_lang"`
 	Files       []string  `bson:"files,omitempty"`
 	CreatedAt   time.Time `bson:"created_at"`
-	Delivered   bool      `bson:"delivered"`
+	Delivered   bool      `bson:"delivered"` // DM only
 	DeliveredAt time.Time `bson:"delivered_at,omitempty"`
+	// ContentLangConfidence is how sure detection was of ContentLang (0-1);
+	// 1 when the client declared the language.
+	ContentLangConfidence float64 `bson:"content_lang_confidence,omitempty"`
+	// Group delivery state: members (minus the sender) at send time, and
+	// which of them have received the message on at least one device.
+	Recipients  []string `bson:"recipients,omitempty"`
+	DeliveredTo []string `bson:"delivered_to,omitempty"`
+	// Edit history, oldest first; Content always holds the latest text.
+	EditedAt *time.Time        `bson:"edited_at,omitempty"`
+	Edits    []MessageRevision `bson:"edits,omitempty"`
+	// Deletion: HiddenFor lists users who deleted the message for
+	// themselves; Deleted marks a tombstone (content removed for everyone).
+	HiddenFor []string   `bson:"hidden_for,omitempty"`
+	Deleted   bool       `bson:"deleted,omitempty"`
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+	DeletedBy string     `bson:"deleted_by,omitempty"`
+	// Reactions maps an emoji to the IDs of the users who reacted with it.
+	Reactions map[string][]string `bson:"reactions,omitempty"`
+	// Threads: a reply points at its root via ThreadID; the root keeps the
+	// reply count, last reply time and everyone who took part.
+	ThreadID           string     `bson:"thread_id,omitempty"`
+	ReplyCount         int        `bson:"reply_count,omitempty"`
+	LastReplyAt        *time.Time `bson:"last_reply_at,omitempty"`
+	ThreadParticipants []string   `bson:"thread_participants,omitempty"`
+	// Mentions holds the resolved user IDs of @mentions in group messages.
+	Mentions []string `bson:"mentions,omitempty"`
+	// ForwardedFrom is the provenance of a forwarded copy.
+	ForwardedFrom *models.ForwardedFrom `bson:"forwarded_from,omitempty"`
+	// ExpiresAt is when a disappearing message gets purged.
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+	// Poll is set on poll messages (groups only).
+	Poll *models.Poll `bson:"poll,omitempty"`
+	// Translations caches the content in other languages, keyed by language.
+	// Cleared whenever the content changes.
+	Translations map[string]string `bson:"translations,omitempty"`
 }
 
-func saveDM(ctx context.Context, fromID, recipientID, text, lang string, files []string, replyTo, replyText, replySender string) error {
-	_, err := db.Messages().InsertOne(ctx, SavedMessage{
-		SenderID:    fromID,
-		RecipientID: recipientID,
-		Content:     text,
-		ReplyTo:     replyTo,
-		ReplyText:   replyText,
-		ReplySender: replySender,
-		ContentLang: lang,
-		Files:       files,
-		CreatedAt:   time.Now(),
-		Delivered:   false,
-	})
+// MessageRevision is a previous version of an edited message.
+type MessageRevision struct {
+	Content     string    `bson:"content"`
+	ContentLang string    `bson:"content_lang"`
+	ReplacedAt  time.Time `bson:"replaced_at"`
+}
+
+// deliveryCount is the delivery progress of one message, as shown to its sender.
+type deliveryCount struct {
+	ID             primitive.ObjectID
+	SenderID       string
+	ConversationID string
+	GroupID        string
+	Delivered      int
+	Total          int
+}
+
+// saveMessage inserts a DM or group message and fills in the server-assigned
+// ID and creation time on m.
+func saveMessage(ctx context.Context, m *SavedMessage) error {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+	res, err := db.Messages().InsertOne(ctx, m)
+	if err != nil {
+		return err
+	}
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		m.ID = oid
+	}
+	return nil
+}
+
+// loadMessage fetches a single DM or group message.
+func loadMessage(ctx context.Context, id primitive.ObjectID) (*SavedMessage, error) {
+	var m SavedMessage
+	if err := db.Messages().FindOne(ctx, bson.M{"_id": id}).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// updateMessageContent replaces the text of a message, keeping the previous
+// version in its edit history. It fails with mongo.ErrNoDocuments when the
+// message changed concurrently.
+func updateMessageContent(ctx context.Context, m *SavedMessage, text, lang string, confidence float64, at time.Time) error {
+	res, err := db.Messages().UpdateOne(ctx,
+		bson.M{"_id": m.ID, "content": m.Content},
+		bson.M{
+			"$set": bson.M{
+				"content":                 text,
+				"content_lang":            lang,
+				"content_lang_confidence": confidence,
+				"edited_at":               at,
+			},
+			"$push": bson.M{"edits": MessageRevision{
+				Content:     m.Content,
+				ContentLang: m.ContentLang,
+				ReplacedAt:  at,
+			}},
+			"$unset": bson.M{"translations": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// loadTranslation returns the stored translation of a message into lang, as
+// long as the message still has the given content.
+func loadTranslation(ctx context.Context, id primitive.ObjectID, content, lang string) (string, bool) {
+	var m SavedMessage
+	err := db.Messages().FindOne(ctx, bson.M{"_id": id, "content": content},
+		options.FindOne().SetProjection(bson.M{"translations." + lang: 1}),
+	).Decode(&m)
+	if err != nil {
+		return "", false
+	}
+	t, ok := m.Translations[lang]
+	return t, ok
+}
+
+// saveTranslation stores the translation of a message into lang. It is a
+// no-op, reporting false, when the message was edited or deleted in the
+// meantime.
+func saveTranslation(ctx context.Context, id primitive.ObjectID, content, lang, text string) (bool, error) {
+	res, err := db.Messages().UpdateOne(ctx,
+		bson.M{"_id": id, "content": content, "deleted": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"translations." + lang: text}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// hideMessageFor removes a message from one user's view.
+func hideMessageFor(ctx context.Context, id primitive.ObjectID, userID string) error {
+	_, err := db.Messages().UpdateByID(ctx, id, bson.M{"$addToSet": bson.M{"hidden_for": userID}})
 	return err
 }
 
-func saveGroupMsg(ctx context.Context, fromID, groupID, text, lang string, files []string, replyTo, replyText, replySender string) error {
-	_, err := db.Messages().InsertOne(ctx, SavedMessage{
-		SenderID:    fromID,
-		GroupID:     groupID,
-		Content:     text,
-		ReplyTo:     replyTo,
-		ReplyText:   replyText,
-		ReplySender: replySender,
-		ContentLang: lang,
-		Files:       files,
-		CreatedAt:   time.Now(),
+// tombstoneMessage deletes a message's content for everyone, keeping a
+// placeholder so replies and history stay consistent.
+func tombstoneMessage(ctx context.Context, id primitive.ObjectID, by string, at time.Time) error {
+	_, err := db.Messages().UpdateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"deleted":    true,
+			"deleted_at": at,
+			"deleted_by": by,
+			"content":    "",
+			"reply_text": "",
+			"files":      []string{},
+		},
+		"$unset": bson.M{"edits": "", "poll": "", "translations": ""},
 	})
 	return err
 }
 
-// fetchUndeliveredDMs returns undelivered direct messages for recipient
-func fetchUndeliveredDMs(ctx context.Context, recipientID string) ([]SavedMessage, error) {
-	cur, err := db.Messages().Find(ctx, map[string]interface{}{"recipient_id": recipientID, "delivered": false})
+// setReaction adds or removes one user's emoji reaction and returns the
+// message's reactions afterwards.
+func setReaction(ctx context.Context, id primitive.ObjectID, userID, emoji string, add bool) (map[string][]string, error) {
+	field := "reactions." + emoji
+	filter := bson.M{"_id": id, "deleted": bson.M{"$ne": true}}
+	update := bson.M{"$pull": bson.M{field: userID}}
+	if add {
+		// a new emoji must fit under both caps; re-adding one is a no-op
+		reactions := bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$reactions", bson.M{}}}}
+		mine := bson.M{"$filter": bson.M{"input": reactions, "cond": bson.M{"$in": bson.A{userID, "$$this.v"}}}}
+		filter["$or"] = []bson.M{
+			{field: userID},
+			{"$and": []bson.M{
+				{"$or": []bson.M{
+					{field: bson.M{"$exists": true}},
+					{"$expr": bson.M{"$lt": bson.A{bson.M{"$size": reactions}, maxReactionKeys}}},
+				}},
+				{"$expr": bson.M{"$lt": bson.A{bson.M{"$size": mine}, maxUserReactions}}},
+			}},
+		}
+		update = bson.M{"$addToSet": bson.M{field: userID}}
+	}
+
+	var m SavedMessage
+	err := db.Messages().FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"reactions": 1}),
+	).Decode(&m)
+	if add && errors.Is(err, mongo.ErrNoDocuments) {
+		// the caller has just loaded the message, so it hit a cap
+		return nil, ErrTooManyReactions
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// drop emojis nobody uses any more
+	if !add && len(m.Reactions[emoji]) == 0 {
+		if _, err := db.Messages().UpdateOne(ctx,
+			bson.M{"_id": id, field: bson.M{"$size": 0}},
+			bson.M{"$unset": bson.M{field: ""}},
+		); err != nil {
+			return nil, err
+		}
+		delete(m.Reactions, emoji)
+	}
+	return m.Reactions, nil
+}
+
+// bumpThread records a new reply on its thread root and returns the updated
+// root. The root's author and the replier both become thread participants.
+func bumpThread(ctx context.Context, root, reply *SavedMessage) (*SavedMessage, error) {
+	var updated SavedMessage
+	err := db.Messages().FindOneAndUpdate(ctx,
+		bson.M{"_id": root.ID},
+		bson.M{
+			"$inc":      bson.M{"reply_count": 1},
+			"$max":      bson.M{"last_reply_at": reply.CreatedAt},
+			"$addToSet": bson.M{"thread_participants": bson.M{"$each": []string{root.SenderID, reply.SenderID}}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// setPollVote stores one user's choices on an open poll and returns the poll
+// afterwards. It fails with mongo.ErrNoDocuments if the poll is closed.
+func setPollVote(ctx context.Context, id primitive.ObjectID, userID string, choices []int) (*models.Poll, error) {
+	field := "poll.votes." + userID
+	update := bson.M{"$unset": bson.M{field: ""}}
+	if len(choices) > 0 {
+		update = bson.M{"$set": bson.M{field: choices}}
+	}
+	var m SavedMessage
+	err := db.Messages().FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "poll": bson.M{"$exists": true}, "poll.closed": bson.M{"$ne": true}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"poll": 1}),
+	).Decode(&m)
+	if err != nil {
+		return nil, err
+	}
+	return m.Poll, nil
+}
+
+// errVotesChanged reports a vote that landed while a poll was being closed.
+var errVotesChanged = errors.New("poll votes changed while closing")
+
+// closePollWithResults closes an open poll and stores its final tally in the
+// same update, so a closed poll never lacks results. The update only applies
+// while the votes are the ones tallied; after a concurrent vote it fails
+// with errVotesChanged. Anonymous polls drop the individual votes once
+// they're counted. It fails with mongo.ErrNoDocuments if the poll was
+// already closed.
+func closePollWithResults(ctx context.Context, id primitive.ObjectID) (*SavedMessage, error) {
+	open := bson.M{"_id": id, "poll": bson.M{"$exists": true}, "poll.closed": bson.M{"$ne": true}}
+	var raw bson.Raw
+	if err := db.Messages().FindOne(ctx, open).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var m SavedMessage
+	if err := bson.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+
+	// the stored votes, byte for byte, so any change makes the filter miss
+	open["poll.votes"] = bson.M{"$exists": false}
+	if votes, err := raw.LookupErr("poll", "votes"); err == nil {
+		open["poll.votes"] = votes
+	}
+	results := m.Poll.Tally()
+	update := bson.M{"$set": bson.M{
+		"poll.closed":       true,
+		"poll.results":      results,
+		"poll.total_voters": len(m.Poll.Votes),
+	}}
+	if m.Poll.Anonymous {
+		update["$unset"] = bson.M{"poll.votes": ""}
+	}
+	res, err := db.Messages().UpdateOne(ctx, open, update)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errVotesChanged
+	}
+	m.Poll.Closed = true
+	m.Poll.Results = results
+	m.Poll.TotalVoters = len(m.Poll.Votes)
+	return &m, nil
+}
+
+// fetchDuePolls returns the IDs of open polls past their close time.
+func fetchDuePolls(ctx context.Context, now time.Time) ([]primitive.ObjectID, error) {
+	cur, err := db.Messages().Find(ctx,
+		bson.M{"poll.closes_at": bson.M{"$lte": now}, "poll.closed": bson.M{"$ne": true}, "deleted": bson.M{"$ne": true}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []SavedMessage
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	return ids, nil
+}
+
+// fetchExpired returns up to limit messages whose expiry has passed.
+func fetchExpired(ctx context.Context, now time.Time, limit int64) ([]SavedMessage, error) {
+	cur, err := db.Messages().Find(ctx,
+		bson.M{"expires_at": bson.M{"$lte": now}},
+		options.Find().SetLimit(limit).SetProjection(bson.M{
+			"sender_id": 1, "recipient_id": 1, "group_id": 1, "conversation_id": 1, "files": 1,
+		}))
+	if err != nil {
+		return nil, err
+	}
+	var out []SavedMessage
+	err = cur.All(ctx, &out)
+	return out, err
+}
+
+// deleteMessage removes a message. It reports false if it was already gone,
+// e.g. purged by another node.
+func deleteMessage(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	res, err := db.Messages().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// fileInUse reports whether any message still references the file URL.
+func fileInUse(ctx context.Context, url string) (bool, error) {
+	n, err := db.Messages().CountDocuments(ctx, bson.M{"files": url}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// fetchUndelivered returns up to limit DMs and group messages the user hasn't
+// received yet, oldest first, starting after the message after (if any).
+func fetchUndelivered(ctx context.Context, userID string, after *SavedMessage, limit int64) ([]SavedMessage, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"recipient_id": userID, "delivered": false},
+		{"recipients": userID, "delivered_to": bson.M{"$ne": userID}},
+	}, "deleted": bson.M{"$ne": true}, "hidden_for": bson.M{"$ne": userID}}
+	if after != nil {
+		filter = bson.M{"$and": []bson.M{filter, {"$or": []bson.M{
+			{"created_at": bson.M{"$gt": after.CreatedAt}},
+			{"created_at": after.CreatedAt, "_id": bson.M{"$gt": after.ID}},
+		}}}}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
+	cur, err := db.Messages().Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -71,9 +402,92 @@ func fetchUndeliveredDMs(ctx context.Context, recipientID string) ([]SavedMessag
 	return out, nil
 }
 
-// markMessagesDelivered sets delivered=true and delivered_at on given messages
-func markMessagesDelivered(ctx context.Context, ids []interface{}) error {
-	// update many by _id in ids
-	_, err := db.Messages().UpdateMany(ctx, map[string]interface{}{"_id": map[string]interface{}{"$in": ids}}, map[string]interface{}{"$set": map[string]interface{}{"delivered": true, "delivered_at": time.Now()}})
-	return err
+// undeliveredTo narrows ids to the messages whose delivery state marking
+// userIDs as reached would change: undelivered DMs to one of them, and group
+// messages missing one of them from delivered_to.
+func undeliveredTo(ctx context.Context, userIDs []string, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cur, err := db.Messages().Find(ctx, bson.M{
+		"_id": bson.M{"$in": ids},
+		"$or": []bson.M{
+			{"recipient_id": bson.M{"$in": userIDs}, "delivered": false},
+			{"recipients": bson.M{"$in": userIDs}, "$expr": bson.M{"$not": bson.A{bson.M{"$setIsSubset": bson.A{
+				bson.M{"$setIntersection": bson.A{userIDs, bson.M{"$ifNull": bson.A{"$recipients", bson.A{}}}}},
+				bson.M{"$ifNull": bson.A{"$delivered_to", bson.A{}}},
+			}}}}},
+		},
+	}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []SavedMessage
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	out := make([]primitive.ObjectID, len(docs))
+	for i, d := range docs {
+		out[i] = d.ID
+	}
+	return out, nil
+}
+
+// markDelivered records that userIDs received the given messages: DMs are
+// flagged delivered, group messages get the users added to delivered_to
+// (only if they were recipients). It returns the new counts of the messages
+// whose state actually changed.
+func markDelivered(ctx context.Context, userIDs []string, ids []primitive.ObjectID) ([]deliveryCount, error) {
+	if len(userIDs) == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+	ids, err := undeliveredTo(ctx, userIDs, ids)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	now := time.Now().UTC()
+
+	_, err = db.Messages().UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "recipient_id": bson.M{"$in": userIDs}, "delivered": false},
+		bson.M{"$set": bson.M{"delivered": true, "delivered_at": now}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Messages().UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "recipients": bson.M{"$in": userIDs}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"delivered_to": bson.M{"$setUnion": bson.A{
+				bson.M{"$ifNull": bson.A{"$delivered_to", bson.A{}}},
+				bson.M{"$setIntersection": bson.A{userIDs, "$recipients"}},
+			}},
+		}}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := db.Messages().Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"sender_id": 1, "conversation_id": 1, "group_id": 1, "delivered": 1, "recipients": 1, "delivered_to": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var msgs []SavedMessage
+	if err := cur.All(ctx, &msgs); err != nil {
+		return nil, err
+	}
+
+	out := make([]deliveryCount, 0, len(msgs))
+	for _, m := range msgs {
+		c := deliveryCount{ID: m.ID, SenderID: m.SenderID, ConversationID: m.ConversationID, GroupID: m.GroupID}
+		if m.GroupID != "" {
+			c.Delivered, c.Total = len(m.DeliveredTo), len(m.Recipients)
+		} else {
+			c.Total = 1
+			if m.Delivered {
+				c.Delivered = 1
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
 }
@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxPins caps how many messages a conversation can have pinned at once.
+const maxPins = 50
+
+var ErrTooManyPins = errors.New("too many pinned messages")
+
+// PinMessage pins or unpins a message in its conversation. Anyone in a DM may
+// pin; in groups only admins can. Participants get message_pinned or
+// message_unpinned.
+func (h *Hub) PinMessage(userID, messageID string, pin bool) error {
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := loadMessage(ctx, oid)
+	if err != nil || m.Deleted || contains(m.HiddenFor, userID) {
+		return ErrMessageNotFound
+	}
+	conv, err := loadConversation(ctx, m.ConversationID)
+	if err != nil {
+		return ErrConversationNotFound
+	}
+	if !conv.IsMember(userID) || !conv.Holds(m) {
+		return ErrMessageNotFound
+	}
+	if !conv.IsDM() && !conv.IsAdmin(userID) {
+		return ErrNotAllowed
+	}
+
+	ev := OutgoingMessage{
+		ID:             messageID,
+		ConversationID: m.ConversationID,
+		GroupID:        m.GroupID,
+		FromUser:       userID,
+	}
+	var changed bool
+	if pin {
+		if len(conv.Pins) >= maxPins {
+			return ErrTooManyPins
+		}
+		now := time.Now().UTC()
+		changed, err = addPin(ctx, conv.ID, models.Pin{MessageID: messageID, PinnedBy: userID, PinnedAt: now})
+		ev.Type = "message_pinned"
+		ev.CreatedAt = &now
+	} else {
+		changed, err = removePin(ctx, conv.ID, messageID)
+		ev.Type = "message_unpinned"
+	}
+	if err != nil {
+		return err
+	}
+	if changed {
+		h.emit(conv.Members, "", ev)
+	}
+	return nil
+}
+
+// unpinDeleted drops a pin when its message is deleted for everyone.
+func (h *Hub) unpinDeleted(ctx context.Context, m *SavedMessage, deletedBy string, audience []string) {
+	convID, err := primitive.ObjectIDFromHex(m.ConversationID)
+	if err != nil {
+		return
+	}
+	if changed, err := removePin(ctx, convID, m.ID.Hex()); err == nil && changed {
+		h.emit(audience, "", OutgoingMessage{
+			Type:           "message_unpinned",
+			ID:             m.ID.Hex(),
+			ConversationID: m.ConversationID,
+			GroupID:        m.GroupID,
+			FromUser:       deletedBy,
+		})
+	}
+}
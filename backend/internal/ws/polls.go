@@ -0,0 +1,197 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	minPollOptions = 2
+	maxPollOptions = 10
+	maxPollOpen    = 30 * 24 * time.Hour
+	// pollInterval is how often each node closes polls past their close time.
+	pollInterval = 15 * time.Second
+)
+
+var (
+	ErrInvalidPoll = errors.New("invalid poll")
+	ErrNotAPoll    = errors.New("message is not a poll")
+	ErrPollClosed  = errors.New("poll is closed")
+	ErrInvalidVote = errors.New("invalid vote")
+)
+
+// newPoll validates a poll sent by a client and returns the stored form.
+func newPoll(p *models.Poll) (*models.Poll, error) {
+	out := &models.Poll{
+		Question:  strings.TrimSpace(p.Question),
+		Multi:     p.Multi,
+		Anonymous: p.Anonymous,
+	}
+	if out.Question == "" {
+		return nil, ErrInvalidPoll
+	}
+	for _, o := range p.Options {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			return nil, ErrInvalidPoll
+		}
+		out.Options = append(out.Options, o)
+	}
+	if len(out.Options) < minPollOptions || len(out.Options) > maxPollOptions {
+		return nil, ErrInvalidPoll
+	}
+	if p.ClosesAt != nil {
+		now := time.Now()
+		if !p.ClosesAt.After(now) || p.ClosesAt.After(now.Add(maxPollOpen)) {
+			return nil, ErrInvalidPoll
+		}
+		at := p.ClosesAt.UTC()
+		out.ClosesAt = &at
+	}
+	return out, nil
+}
+
+// Vote replaces the user's choices on a poll; no choices retracts the vote.
+// Group members get poll_updated with the new results.
+func (h *Hub) Vote(userID, messageID string, choices []int) error {
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := loadMessage(ctx, oid)
+	if err != nil || m.Deleted {
+		return ErrMessageNotFound
+	}
+	if m.Poll == nil {
+		return ErrNotAPoll
+	}
+	members := h.groupMembers(m.GroupID)
+	if !contains(members, userID) {
+		return ErrMessageNotFound
+	}
+	if m.Poll.Closed || (m.Poll.ClosesAt != nil && !m.Poll.ClosesAt.After(time.Now())) {
+		return ErrPollClosed
+	}
+	if !m.Poll.Multi && len(choices) > 1 {
+		return ErrInvalidVote
+	}
+	seen := make(map[int]bool, len(choices))
+	for _, c := range choices {
+		if c < 0 || c >= len(m.Poll.Options) || seen[c] {
+			return ErrInvalidVote
+		}
+		seen[c] = true
+	}
+
+	poll, err := setPollVote(ctx, oid, userID, choices)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// closed between the check and the update
+		return ErrPollClosed
+	}
+	if err != nil {
+		return err
+	}
+	m.Poll = poll
+	h.emitPoll(m, members)
+	return nil
+}
+
+// ClosePoll closes a poll early. Only its creator or a group admin may.
+func (h *Hub) ClosePoll(userID, messageID string) error {
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := loadMessage(ctx, oid)
+	if err != nil || m.Deleted {
+		return ErrMessageNotFound
+	}
+	if m.Poll == nil {
+		return ErrNotAPoll
+	}
+	if !contains(h.groupMembers(m.GroupID), userID) {
+		return ErrMessageNotFound
+	}
+	if m.SenderID != userID && !h.isGroupAdmin(ctx, m.GroupID, userID) {
+		return ErrNotAllowed
+	}
+	return h.closePoll(ctx, oid)
+}
+
+// closePoll freezes the poll with its final results and broadcasts them.
+// Closing an already closed poll does nothing.
+func (h *Hub) closePoll(ctx context.Context, id primitive.ObjectID) error {
+	var m *SavedMessage
+	var err error
+	// a vote arriving mid-close means tallying again
+	for attempt := 0; attempt < 3; attempt++ {
+		m, err = closePollWithResults(ctx, id)
+		if !errors.Is(err, errVotesChanged) {
+			break
+		}
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	h.emitPoll(m, h.groupMembers(m.GroupID))
+	return nil
+}
+
+func (h *Hub) emitPoll(m *SavedMessage, members []string) {
+	h.emit(members, "", OutgoingMessage{
+		Type:           "poll_updated",
+		ID:             m.ID.Hex(),
+		ConversationID: m.ConversationID,
+		GroupID:        m.GroupID,
+		Poll:           m.Poll.View(),
+	})
+}
+
+// RunPolls closes polls whose close time has passed until ctx is done.
+func (h *Hub) RunPolls(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.closeDuePolls(ctx)
+		}
+	}
+}
+
+func (h *Hub) closeDuePolls(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	ids, err := fetchDuePolls(ctx, time.Now().UTC())
+	if err != nil {
+		log.Printf("⚠️ failed to look up due polls: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := h.closePoll(ctx, id); err != nil {
+			log.Printf("⚠️ failed to close poll %s: %v", id.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidEmoji     = errors.New("invalid emoji")
+	ErrTooManyReactions = errors.New("too many reactions")
+)
+
+const (
+	// maxEmojiLen bounds a reaction key; multi-codepoint emoji (skin tones,
+	// ZWJ sequences) need a few runes.
+	maxEmojiLen = 16
+	// maxReactionKeys caps the distinct emoji on one message, and
+	// maxUserReactions the distinct emoji one user puts on it.
+	maxReactionKeys  = 20
+	maxUserReactions = 5
+)
+
+// React adds or removes the user's emoji reaction on a message and
+// broadcasts the updated reaction summary to the conversation.
+func (h *Hub) React(userID, messageID, emoji string, add bool) error {
+	if !validEmoji(emoji) {
+		return ErrInvalidEmoji
+	}
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := loadMessage(ctx, oid)
+	if err != nil || m.Deleted {
+		return ErrMessageNotFound
+	}
+	audience := h.messageAudience(m)
+	if !contains(audience, userID) {
+		return ErrMessageNotFound
+	}
+
+	reactions, err := setReaction(ctx, oid, userID, emoji, add)
+	if errors.Is(err, ErrTooManyReactions) {
+		return err
+	}
+	if err != nil {
+		return ErrMessageNotFound
+	}
+
+	h.emit(audience, "", OutgoingMessage{
+		Type:           "reaction_updated",
+		ID:             messageID,
+		ConversationID: m.ConversationID,
+		GroupID:        m.GroupID,
+		FromUser:       userID,
+		Emoji:          emoji,
+		Reactions:      models.SummarizeReactions(reactions),
+	})
+	return nil
+}
+
+// validEmoji accepts exactly one emoji: a flag, a keycap, a tag sequence
+// (e.g. the Scotland flag) or pictographs with optional variation selector
+// and skin tone, joined by ZWJ. Such keys are also safe Mongo field names.
+func validEmoji(emoji string) bool {
+	r := []rune(emoji)
+	if len(r) == 0 || len(r) > maxEmojiLen {
+		return false
+	}
+	switch {
+	case isRegionalIndicator(r[0]):
+		return len(r) == 2 && isRegionalIndicator(r[1])
+	case r[0] == '#' || r[0] == '*' || r[0] >= '0' && r[0] <= '9':
+		return len(r) == 2 && r[1] == 0x20E3 || len(r) == 3 && r[1] == 0xFE0F && r[2] == 0x20E3
+	case r[0] == 0x1F3F4 && len(r) > 1 && isTag(r[1]):
+		for i := 1; i < len(r)-1; i++ {
+			if !isTag(r[i]) {
+				return false
+			}
+		}
+		return r[len(r)-1] == 0xE007F
+	}
+
+	// pictograph (FE0F)? (skin tone)? (ZWJ pictograph ...)*
+	for i := 0; ; i++ {
+		if i >= len(r) || !isPictograph(r[i]) {
+			return false
+		}
+		if i+1 < len(r) && r[i+1] == 0xFE0F {
+			i++
+		}
+		if i+1 < len(r) && isSkinTone(r[i+1]) {
+			i++
+		}
+		if i+1 == len(r) {
+			return true
+		}
+		if r[i+1] != 0x200D {
+			return false
+		}
+		i++
+	}
+}
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1F1E6 && r <= 0x1F1FF }
+func isSkinTone(r rune) bool          { return r >= 0x1F3FB && r <= 0x1F3FF }
+func isTag(r rune) bool               { return r >= 0xE0020 && r <= 0xE007E }
+
+// pictographs are the emoji blocks plus the older symbols that have emoji
+// presentation (©, ™, arrows, ☀ and the dingbats).
+var pictographs = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21A9, 0x21AA},
+	{0x231A, 0x231B}, {0x2328, 0x2328}, {0x23CF, 0x23CF}, {0x23E9, 0x23F3},
+	{0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB}, {0x25B6, 0x25B6},
+	{0x25C0, 0x25C0}, {0x25FB, 0x25FE}, {0x2600, 0x27BF}, {0x2934, 0x2935},
+	{0x2B05, 0x2B07}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55},
+	{0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3297}, {0x3299, 0x3299},
+	{0x1F000, 0x1F1E5}, {0x1F200, 0x1F3FA}, {0x1F400, 0x1FAFF},
+}
+
+func isPictograph(r rune) bool {
+	for _, p := range pictographs {
+		if r >= p[0] && r <= p[1] {
+			return true
+		}
+	}
+	return false
+}
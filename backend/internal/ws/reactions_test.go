@@ -0,0 +1,39 @@
+package ws
+
+import "testing"
+
+func TestValidEmoji(t *testing.T) {
+	for _, tc := range []struct {
+		emoji string
+		want  bool
+	}{
+		{"👍", true},
+		{"👍🏽", true},      // skin tone
+		{"❤️", true},      // variation selector
+		{"❤", true},       // text presentation
+		{"👩‍💻", true},     // ZWJ sequence
+		{"👨‍👩‍👧‍👦", true}, // family
+		{"🏳️‍🌈", true},    // ZWJ with variation selector
+		{"🇯🇵", true},      // flag
+		{"1️⃣", true},     // keycap
+		{"#⃣", true},      // keycap without variation selector
+		{"🏴󠁧󠁢󠁳󠁣󠁴󠁿", true}, // tag sequence
+		{"", false},
+		{"a", false},
+		{"ok", false},
+		{"1", false},
+		{"👍👍", false}, // two emoji
+		{"👍a", false},
+		{"🇯", false}, // half a flag
+		{"🇯🇵🇫", false},
+		{"👩‍", false}, // dangling ZWJ
+		{"🏽", false},  // skin tone alone
+		{"👍.", false},
+		{"$set", false},
+		{"中", false},
+	} {
+		if got := validEmoji(tc.emoji); got != tc.want {
+			t.Errorf("validEmoji(%q) = %v, want %v", tc.emoji, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"realtime-chat/internal/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReadCursor is how far a user has read in a conversation: every message up
+// to and including MessageID counts as read.
+type ReadCursor struct {
+	UserID         string             `bson:"user_id"`
+	ConversationID string             `bson:"conversation_id"`
+	MessageID      primitive.ObjectID `bson:"message_id"`
+	ReadAt         time.Time          `bson:"read_at"`
+}
+
+// advanceReadCursor moves the user's cursor forward to messageID. It reports
+// false when the cursor was already at or past that message.
+func advanceReadCursor(ctx context.Context, userID, conversationID string, messageID primitive.ObjectID, at time.Time) (bool, error) {
+	var before ReadCursor
+	err := db.ReadCursors().FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "conversation_id": conversationID},
+		bson.M{
+			"$max": bson.M{"message_id": messageID, "read_at": at},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return true, nil // first cursor for this conversation
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Compare(before.MessageID[:], messageID[:]) < 0, nil
+}
+
+// messageInConversation checks that a message belongs to the conversation.
+// Older DMs have no conversation_id, so they match on the two participants.
+func messageInConversation(ctx context.Context, messageID primitive.ObjectID, conv *GroupDoc) (bool, error) {
+	convID := conv.ID.Hex()
+	n, err := db.Messages().CountDocuments(ctx, bson.M{
+		"_id": messageID,
+		"$or": []bson.M{
+			{"conversation_id": convID},
+			{"group_id": convID},
+			{"sender_id": bson.M{"$in": conv.Members}, "recipient_id": bson.M{"$in": conv.Members}},
+		},
+	})
+	return n > 0, err
+}
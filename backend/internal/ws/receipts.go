@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"realtime-chat/internal/db"
+	"realtime-chat/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrMessageNotFound      = errors.New("message not found")
+)
+
+// MarkRead advances the reader's cursor in a conversation up to messageID
+// and tells the other participants, unless the reader turned read receipts
+// off. The reader's own devices are always told, to keep them in sync.
+func (h *Hub) MarkRead(userID, conversationID, messageID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conv, err := loadConversation(ctx, conversationID)
+	if err != nil {
+		return ErrConversationNotFound
+	}
+	if !conv.IsMember(userID) {
+		return ErrNotGroupMember
+	}
+	oid, err := primitive.ObjectIDFromHex(messageID)
+	if err != nil {
+		return ErrMessageNotFound
+	}
+	if ok, err := messageInConversation(ctx, oid, conv); err != nil {
+		return err
+	} else if !ok {
+		return ErrMessageNotFound
+	}
+
+	now := time.Now().UTC()
+	advanced, err := advanceReadCursor(ctx, userID, conversationID, oid, now)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		return nil
+	}
+
+	to := []string{userID}
+	if sendsReadReceipts(ctx, userID) {
+		to = conv.Members
+	}
+	h.emit(to, "", OutgoingMessage{
+		Type:           "read_receipt",
+		ID:             messageID,
+		ConversationID: conversationID,
+		FromUser:       userID,
+		ReadAt:         &now,
+	})
+	return nil
+}
+
+// sendsReadReceipts looks up the user's privacy preference (default on).
+func sendsReadReceipts(ctx context.Context, userID string) bool {
+	oid, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return true
+	}
+	var u models.User
+	if err := db.Users().FindOne(ctx, bson.M{"_id": oid}).Decode(&u); err != nil {
+		log.Printf("⚠️ read receipts: cannot load user %s: %v", userID, err)
+		return true
+	}
+	return u.SendsReadReceipts()
+}
@@ -0,0 +1,179 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// schedulerInterval is how often each node looks for due messages.
+	schedulerInterval = 5 * time.Second
+	// schedulerLease is how long a claimed message may stay in "sending"
+	// before another node assumes the claimer died and takes it over.
+	schedulerLease = 2 * time.Minute
+	// maxScheduleAhead limits how far in the future a message can be scheduled.
+	maxScheduleAhead = 365 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidSendTime   = errors.New("send time must be in the future")
+	ErrScheduledNotFound = errors.New("scheduled message not found")
+)
+
+// ScheduleMessage validates and stores a message to be sent at s.SendAt.
+// The sender must belong to the target conversation now; membership is
+// checked again when the message is sent.
+func (h *Hub) ScheduleMessage(s *ScheduledMessage) error {
+	now := time.Now()
+	if !s.SendAt.After(now) || s.SendAt.After(now.Add(maxScheduleAhead)) {
+		return ErrInvalidSendTime
+	}
+	if s.Content == "" && len(s.Files) == 0 {
+		return ErrEmptyMessage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	switch s.ChatType {
+	case "dm":
+		peer, err := dmPeer(ctx, s.SenderID, s.ConversationID, s.RecipientID)
+		if err != nil {
+			return err
+		}
+		s.RecipientID = peer
+	case "group":
+		members := h.groupMembers(s.GroupID)
+		if len(members) == 0 {
+			return ErrGroupNotFound
+		}
+		if !contains(members, s.SenderID) {
+			return ErrNotGroupMember
+		}
+		s.ConversationID = s.GroupID
+	default:
+		return ErrInvalidTarget
+	}
+
+	s.SendAt = s.SendAt.UTC()
+	return saveScheduled(ctx, s)
+}
+
+// CancelScheduled cancels one of the user's pending scheduled messages.
+func (h *Hub) CancelScheduled(userID, scheduledID string) error {
+	oid, err := primitive.ObjectIDFromHex(scheduledID)
+	if err != nil {
+		return ErrScheduledNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ok, err := cancelScheduled(ctx, userID, oid)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrScheduledNotFound
+	}
+	return nil
+}
+
+// ScheduledMessages lists the user's pending scheduled messages.
+func (h *Hub) ScheduledMessages(userID string) ([]ScheduledMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return listScheduled(ctx, userID)
+}
+
+// RunScheduler sends due scheduled messages until ctx is done. Every node
+// may run it: a message is claimed atomically before it is sent, and its
+// message ID is fixed at the first claim, so a retry after a crash is
+// rejected by the database instead of storing the message twice.
+func (h *Hub) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.dispatchDue(ctx)
+		}
+	}
+}
+
+func (h *Hub) dispatchDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		claimCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		s, err := claimDueScheduled(claimCtx, h.nodeID, time.Now().UTC(), schedulerLease)
+		cancel()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			log.Printf("⚠️ scheduler: failed to claim due messages: %v", err)
+			return
+		}
+		h.sendScheduled(s)
+	}
+}
+
+// sendScheduled sends a claimed message and records the outcome.
+func (h *Hub) sendScheduled(s *ScheduledMessage) {
+	m := &SavedMessage{
+		ID:                    *s.MessageID,
+		SenderID:              s.SenderID,
+		RecipientID:           s.RecipientID,
+		GroupID:               s.GroupID,
+		ConversationID:        s.ConversationID,
+		Content:               s.Content,
+		ContentLang:           s.ContentLang,
+		Files:                 s.Files,
+		ThreadID:              s.ThreadID,
+		ContentLangConfidence: s.LangConfidence,
+	}
+	var err error
+	if s.ChatType == "group" {
+		err = h.SendToGroup(m)
+	} else {
+		err = h.SendDM(m)
+	}
+
+	status, errText := ScheduledSent, ""
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		// an earlier attempt already stored it
+		log.Printf("⏰ scheduled message %s was already sent", s.ID.Hex())
+	case err != nil:
+		status, errText = ScheduledFailed, sendErrorCode(err)
+		log.Printf("⚠️ scheduled message %s failed: %v", s.ID.Hex(), err)
+	default:
+		log.Printf("⏰ scheduled message %s sent as %s", s.ID.Hex(), m.ID.Hex())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := finishScheduled(ctx, s.ID, status, errText); err != nil {
+		log.Printf("⚠️ failed to record scheduled message %s: %v", s.ID.Hex(), err)
+	}
+
+	// let the sender's devices update their scheduled list
+	ev := OutgoingMessage{
+		Type:           "scheduled_message_sent",
+		ID:             m.ID.Hex(),
+		ScheduledID:    s.ID.Hex(),
+		ConversationID: s.ConversationID,
+		GroupID:        s.GroupID,
+		Error:          errText,
+	}
+	if status == ScheduledFailed {
+		ev.Type = "scheduled_message_failed"
+		ev.ID = ""
+	}
+	h.emit([]string{s.SenderID}, "", ev)
+}
@@ -0,0 +1,125 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"realtime-chat/internal/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// scheduled message states
+const (
+	ScheduledPending  = "pending"
+	ScheduledSending  = "sending"
+	ScheduledSent     = "sent"
+	ScheduledCanceled = "canceled"
+	ScheduledFailed   = "failed"
+)
+
+// ScheduledMessage is a message waiting in the scheduled_messages collection
+// until SendAt. MessageID is fixed when a node first claims it, so a retry
+// after a crash reuses it and can't store the message twice.
+type ScheduledMessage struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	SenderID       string              `bson:"sender_id" json:"sender_id"`
+	ChatType       string              `bson:"chat_type" json:"chat_type"` // "dm" | "group"
+	RecipientID    string              `bson:"recipient_id,omitempty" json:"recipient_id,omitempty"`
+	GroupID        string              `bson:"group_id,omitempty" json:"group_id,omitempty"`
+	ConversationID string              `bson:"conversation_id,omitempty" json:"conversation_id,omitempty"`
+	Content        string              `bson:"content" json:"content"`
+	ContentLang    string              `bson:"content_lang" json:"content_lang"`
+	LangConfidence float64             `bson:"content_lang_confidence,omitempty" json:"content_lang_confidence,omitempty"`
+	Files          []string            `bson:"files,omitempty" json:"files,omitempty"`
+	ThreadID       string              `bson:"thread_id,omitempty" json:"thread_id,omitempty"`
+	SendAt         time.Time           `bson:"send_at" json:"send_at"`
+	Status         string              `bson:"status" json:"status"`
+	ClaimedBy      string              `bson:"claimed_by,omitempty" json:"-"`
+	ClaimedAt      *time.Time          `bson:"claimed_at,omitempty" json:"-"`
+	MessageID      *primitive.ObjectID `bson:"message_id,omitempty" json:"message_id,omitempty"`
+	SentAt         *time.Time          `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	Error          string              `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+}
+
+func saveScheduled(ctx context.Context, s *ScheduledMessage) error {
+	s.Status = ScheduledPending
+	s.CreatedAt = time.Now().UTC()
+	res, err := db.Scheduled().InsertOne(ctx, s)
+	if err != nil {
+		return err
+	}
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		s.ID = oid
+	}
+	return nil
+}
+
+// claimDueScheduled atomically takes one due message for this node. Messages
+// stuck in "sending" longer than lease (the node died mid-send) are claimed
+// again. It returns mongo.ErrNoDocuments when nothing is due.
+func claimDueScheduled(ctx context.Context, nodeID string, now time.Time, lease time.Duration) (*ScheduledMessage, error) {
+	var s ScheduledMessage
+	err := db.Scheduled().FindOneAndUpdate(ctx,
+		bson.M{"$or": []bson.M{
+			{"status": ScheduledPending, "send_at": bson.M{"$lte": now}},
+			{"status": ScheduledSending, "claimed_at": bson.M{"$lt": now.Add(-lease)}},
+		}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"status":     ScheduledSending,
+			"claimed_by": nodeID,
+			"claimed_at": now,
+			"message_id": bson.M{"$ifNull": bson.A{"$message_id", primitive.NewObjectID()}},
+		}}}},
+		options.FindOneAndUpdate().
+			SetSort(bson.M{"send_at": 1}).
+			SetReturnDocument(options.After),
+	).Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// finishScheduled records the outcome of a send attempt.
+func finishScheduled(ctx context.Context, id primitive.ObjectID, status, errText string) error {
+	set := bson.M{"status": status}
+	if status == ScheduledSent {
+		set["sent_at"] = time.Now().UTC()
+	}
+	if errText != "" {
+		set["error"] = errText
+	}
+	_, err := db.Scheduled().UpdateByID(ctx, id, bson.M{"$set": set})
+	return err
+}
+
+// cancelScheduled cancels a pending message of the user. It reports false if
+// there was no such message or it is already being sent.
+func cancelScheduled(ctx context.Context, userID string, id primitive.ObjectID) (bool, error) {
+	res, err := db.Scheduled().UpdateOne(ctx,
+		bson.M{"_id": id, "sender_id": userID, "status": ScheduledPending},
+		bson.M{"$set": bson.M{"status": ScheduledCanceled}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// listScheduled returns the user's pending messages, soonest first.
+func listScheduled(ctx context.Context, userID string) ([]ScheduledMessage, error) {
+	cur, err := db.Scheduled().Find(ctx,
+		bson.M{"sender_id": userID, "status": ScheduledPending},
+		options.Find().SetSort(bson.M{"send_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var out []ScheduledMessage
+	err = cur.All(ctx, &out)
+	return out, err
+}
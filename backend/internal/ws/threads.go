@@ -0,0 +1,83 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidThread = errors.New("invalid thread root")
+
+// threadRoot validates m.ThreadID and returns the root message. Replies to a
+// reply are attached to the same root, so threads stay one level deep.
+func threadRoot(ctx context.Context, m *SavedMessage) (*SavedMessage, error) {
+	oid, err := primitive.ObjectIDFromHex(m.ThreadID)
+	if err != nil {
+		return nil, ErrInvalidThread
+	}
+	root, err := loadMessage(ctx, oid)
+	if err != nil || root.Deleted {
+		return nil, ErrInvalidThread
+	}
+	if root.ThreadID != "" {
+		if oid, err = primitive.ObjectIDFromHex(root.ThreadID); err != nil {
+			return nil, ErrInvalidThread
+		}
+		if root, err = loadMessage(ctx, oid); err != nil || root.Deleted {
+			return nil, ErrInvalidThread
+		}
+	}
+
+	// the root must live in the same conversation as the reply
+	sameConversation := false
+	if m.GroupID != "" {
+		sameConversation = root.GroupID == m.GroupID
+	} else {
+		sameConversation = root.GroupID == "" &&
+			((root.SenderID == m.SenderID && root.RecipientID == m.RecipientID) ||
+				(root.SenderID == m.RecipientID && root.RecipientID == m.SenderID))
+	}
+	if !sameConversation {
+		return nil, ErrInvalidThread
+	}
+
+	m.ThreadID = root.ID.Hex()
+	return root, nil
+}
+
+// onThreadReply updates the thread root after a reply was stored, pushes the
+// new counts to the conversation and notifies the thread's participants.
+func (h *Hub) onThreadReply(root, reply *SavedMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	updated, err := bumpThread(ctx, root, reply)
+	if err != nil {
+		log.Printf("⚠️ failed to update thread %s: %v", root.ID.Hex(), err)
+		return
+	}
+
+	h.emit(h.messageAudience(updated), "", OutgoingMessage{
+		Type:           "thread_updated",
+		ID:             updated.ID.Hex(),
+		ConversationID: updated.ConversationID,
+		GroupID:        updated.GroupID,
+		ReplyCount:     updated.ReplyCount,
+		LastReplyAt:    updated.LastReplyAt,
+	})
+
+	var notify []string
+	for _, id := range updated.ThreadParticipants {
+		if id != reply.SenderID {
+			notify = append(notify, id)
+		}
+	}
+	if len(notify) > 0 {
+		ev := messageEvent(reply)
+		ev.Type = "thread_reply"
+		h.emit(notify, reply.ContentLang, ev)
+	}
+}
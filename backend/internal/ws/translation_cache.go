@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+// translationCacheSize bounds how many translations a node keeps in memory.
+const translationCacheSize = 10000
+
+// translationKey identifies one message text in one target language. The
+// text is hashed so an edited message never hits its old translation.
+type translationKey struct {
+	messageID string
+	to        string
+	text      [sha256.Size]byte
+}
+
+func newTranslationKey(messageID, text, to string) translationKey {
+	return translationKey{messageID: messageID, to: to, text: sha256.Sum256([]byte(text))}
+}
+
+type translationEntry struct {
+	key  translationKey
+	text string
+}
+
+// translationCache is a fixed-size LRU of translated message texts.
+type translationCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front = most recently used
+	items map[translationKey]*list.Element
+}
+
+func newTranslationCache(size int) *translationCache {
+	return &translationCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[translationKey]*list.Element),
+	}
+}
+
+func (c *translationCache) get(key translationKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*translationEntry).text, true
+}
+
+func (c *translationCache) put(key translationKey, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*translationEntry).text = text
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&translationEntry{key: key, text: text})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*translationEntry).key)
+	}
+}
@@ -0,0 +1,221 @@
+package ws
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"realtime-chat/internal/config"
+	"realtime-chat/internal/models"
+)
+
+// translationStats is published on /debug/vars as "translation".
+var translationStats = expvar.NewMap("translation")
+
+// translationJob is one text to translate into one language, and the
+// devices waiting for the result. done is closed once text and ok are set.
+type translationJob struct {
+	key     translationKey
+	from    string
+	event   OutgoingMessage // the message_translated event to send, minus text
+	waiters []*Client
+
+	done chan struct{}
+	text string
+	ok   bool
+}
+
+// translationPool runs translations off the delivery path. Jobs for the
+// same text and language are merged, so each is translated once however
+// many devices asked for it.
+type translationPool struct {
+	jobs chan *translationJob
+
+	mu      sync.Mutex
+	pending map[translationKey]*translationJob
+}
+
+func newTranslationPool(queue int) *translationPool {
+	if queue <= 0 {
+		queue = 1000
+	}
+	return &translationPool{
+		jobs:    make(chan *translationJob, queue),
+		pending: make(map[translationKey]*translationJob),
+	}
+}
+
+// localize sets out's text for c without blocking: a cached translation is
+// used directly; otherwise the original goes out marked translation_pending
+// and a message_translated event follows once the translation is done.
+func (h *Hub) localize(c *Client, out *OutgoingMessage, srcLang string) {
+	to := c.preferredLang
+	// nothing to do when the text is already in the device's language
+	if srcLang == "" || out.Text == "" || !h.Translates(srcLang, to) {
+		return
+	}
+	key := newTranslationKey(out.ID, out.Text, to)
+	if text, ok := h.translations.get(key); ok {
+		translationStats.Add("cache_hits", 1)
+		out.Text = text
+		return
+	}
+	if h.queueTranslation(c, key, out, srcLang) {
+		out.TranslationPending = true
+	}
+}
+
+// queueTranslation adds c to the job for key, creating the job if needed.
+// It returns false when the queue is full and the original must stand.
+func (h *Hub) queueTranslation(c *Client, key translationKey, out *OutgoingMessage, from string) bool {
+	_, ok := h.enqueueTranslation(c, key, *out, from)
+	return ok
+}
+
+// enqueueTranslation returns the job for key, creating it from out if
+// needed, with c (when not nil) added to its waiters. It returns false when
+// the queue is full.
+func (h *Hub) enqueueTranslation(c *Client, key translationKey, out OutgoingMessage, from string) (*translationJob, bool) {
+	p := h.translationPool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if job, ok := p.pending[key]; ok {
+		if c != nil {
+			job.waiters = append(job.waiters, c)
+		}
+		return job, true
+	}
+	job := &translationJob{
+		key:  key,
+		from: from,
+		event: OutgoingMessage{
+			Type:           "message_translated",
+			ID:             out.ID,
+			ChatType:       out.ChatType,
+			ConversationID: out.ConversationID,
+			GroupID:        out.GroupID,
+			Text:           out.Text,
+			EditedAt:       out.EditedAt, // the revision translated
+			Lang:           key.to,
+		},
+		done: make(chan struct{}),
+	}
+	if c != nil {
+		job.waiters = []*Client{c}
+	}
+	select {
+	case p.jobs <- job:
+		p.pending[key] = job
+		translationStats.Add("queued", 1)
+		return job, true
+	default:
+		translationStats.Add("dropped", 1)
+		return nil, false
+	}
+}
+
+// TranslateMessage translates a stored message into to for the history
+// endpoints. It goes through the same workers, cache and stored
+// translations as live delivery and waits for the result until ctx is done.
+// pending then reports that the translation is still queued or running; it
+// is stored when it finishes, so a later page load picks it up.
+func (h *Hub) TranslateMessage(ctx context.Context, m *models.Message, to string) (text string, ok, pending bool) {
+	if m.Content == "" || !h.Translates(m.ContentLang, to) {
+		return m.Content, false, false
+	}
+	key := newTranslationKey(m.ID, m.Content, to)
+	if text, ok := h.translations.get(key); ok {
+		translationStats.Add("cache_hits", 1)
+		return text, true, false
+	}
+	out := OutgoingMessage{
+		ID:             m.ID,
+		ConversationID: m.ConversationID,
+		GroupID:        m.GroupID,
+		Text:           m.Content,
+	}
+	if m.GroupID != "" {
+		out.ChatType = "group"
+	} else {
+		out.ChatType = "dm"
+	}
+	job, queued := h.enqueueTranslation(nil, key, out, m.ContentLang)
+	if !queued {
+		return m.Content, false, false
+	}
+	select {
+	case <-job.done:
+		return job.text, job.ok, false
+	case <-ctx.Done():
+		return m.Content, false, true
+	}
+}
+
+// RunTranslations runs the translation workers until ctx is cancelled.
+func (h *Hub) RunTranslations(ctx context.Context) {
+	workers := config.C.TranslateWorkers
+	if workers <= 0 {
+		workers = 4
+	}
+	translationStats.Set("queue_depth", expvar.Func(func() any {
+		return len(h.translationPool.jobs)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-h.translationPool.jobs:
+					h.runTranslation(job)
+				}
+			}
+		}()
+	}
+	log.Printf("🌐 Started %d translation workers", workers)
+	wg.Wait()
+}
+
+func (h *Hub) runTranslation(job *translationJob) {
+	start := time.Now()
+	text, ok, stale := h.translateMessage(job.event.ID, job.event.Text, job.from, job.key.to)
+	translationStats.Add("latency_ms_total", time.Since(start).Milliseconds())
+	// devices already show the original, so an unchanged text needs no event
+	unchanged := ok && text == job.event.Text
+	switch {
+	case stale:
+		// edited or deleted meanwhile: the newer revision gets its own job
+		translationStats.Add("stale", 1)
+		text, ok = job.event.Text, false
+	case unchanged:
+		translationStats.Add("unchanged", 1)
+	case ok:
+		translationStats.Add("completed", 1)
+	default:
+		translationStats.Add("failed", 1)
+	}
+
+	p := h.translationPool
+	p.mu.Lock()
+	delete(p.pending, job.key)
+	waiters := job.waiters
+	job.text, job.ok = text, ok
+	close(job.done)
+	p.mu.Unlock()
+	if stale || unchanged {
+		return
+	}
+
+	ev := job.event
+	ev.Text = text
+	ev.TranslationFailed = !ok
+	for _, c := range waiters {
+		c.deliver(ev)
+	}
+}
@@ -0,0 +1,122 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"realtime-chat/internal/models"
+	"realtime-chat/internal/translate"
+)
+
+func newTranslationHub(tr translate.Translator) *Hub {
+	return &Hub{
+		translator:      tr,
+		translations:    newTranslationCache(16),
+		translationPool: newTranslationPool(16),
+	}
+}
+
+func TestLocalizeTranslatesInBackground(t *testing.T) {
+	h := newTranslationHub(translate.Fake{})
+	c := &Client{send: make(chan []byte, 4), preferredLang: "es"}
+
+	out := OutgoingMessage{Type: "message", ID: "m1", ConversationID: "c1", Text: "hello"}
+	h.localize(c, &out, "en")
+	if !out.TranslationPending || out.Text != "hello" {
+		t.Fatalf("uncached text should go out as is, pending: %+v", out)
+	}
+
+	h.runTranslation(<-h.translationPool.jobs)
+	var ev OutgoingMessage
+	if err := json.Unmarshal(<-c.send, &ev); err != nil {
+		t.Fatal(err)
+	}
+	want := "[translated en->es] hello"
+	if ev.Type != "message_translated" || ev.ID != "m1" || ev.ConversationID != "c1" || ev.Text != want {
+		t.Errorf("got %+v, want message_translated of m1 with %q", ev, want)
+	}
+
+	// cached translations go out directly (IDs that aren't ObjectIDs skip
+	// the cache and the store, which need the database)
+	h.translations.put(newTranslationKey("m3", "good night", "es"), "buenas noches")
+	cached := OutgoingMessage{Type: "message", ID: "m3", Text: "good night"}
+	h.localize(c, &cached, "en")
+	if cached.TranslationPending || cached.Text != "buenas noches" {
+		t.Errorf("cached translation not used: %+v", cached)
+	}
+
+	// same language: nothing to translate
+	same := OutgoingMessage{Type: "message", ID: "m2", Text: "hola"}
+	h.localize(c, &same, "es-MX")
+	if same.TranslationPending || same.Text != "hola" {
+		t.Errorf("text already in the device's language was touched: %+v", same)
+	}
+}
+
+// blockingTranslator never answers before its context ends.
+type blockingTranslator struct{}
+
+func (blockingTranslator) Translate(ctx context.Context, text, from, to string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestTranslateMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := newTranslationHub(translate.Fake{})
+	go h.RunTranslations(ctx)
+
+	m := &models.Message{ID: "m1", GroupID: "g1", Content: "bonjour", ContentLang: "fr"}
+	text, ok, pending := h.TranslateMessage(ctx, m, "en")
+	if want := "[translated fr->en] bonjour"; text != want || !ok || pending {
+		t.Errorf("got (%q, %v, %v), want (%q, true, false)", text, ok, pending, want)
+	}
+}
+
+func TestTranslateMessagePendingAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := newTranslationHub(blockingTranslator{})
+	go h.RunTranslations(ctx)
+
+	page, done := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer done()
+	m := &models.Message{ID: "m1", Content: "bonjour", ContentLang: "fr"}
+	text, ok, pending := h.TranslateMessage(page, m, "en")
+	if text != "bonjour" || ok || !pending {
+		t.Errorf("got (%q, %v, %v), want the original, pending", text, ok, pending)
+	}
+}
+
+// echoTranslator hands text back as a real translator does for names and links.
+type echoTranslator struct{}
+
+func (echoTranslator) Translate(_ context.Context, text, _, _ string) (string, error) {
+	return text, nil
+}
+
+func TestLocalizeSkipsUnchangedText(t *testing.T) {
+	// the "none" translator is never asked
+	h := newTranslationHub(translate.Noop{})
+	c := &Client{send: make(chan []byte, 4), preferredLang: "es"}
+	out := OutgoingMessage{Type: "message", ID: "m1", Text: "hello"}
+	h.localize(c, &out, "en")
+	if out.TranslationPending || len(h.translationPool.jobs) != 0 {
+		t.Errorf("noop translator queued a translation: %+v", out)
+	}
+
+	// a translation identical to the original sends no event
+	h = newTranslationHub(echoTranslator{})
+	out = OutgoingMessage{Type: "message", ID: "m1", Text: "Zoë"}
+	h.localize(c, &out, "en")
+	if !out.TranslationPending {
+		t.Fatalf("expected a queued translation: %+v", out)
+	}
+	h.runTranslation(<-h.translationPool.jobs)
+	if n := len(c.send); n != 0 {
+		t.Errorf("unchanged translation sent %d events", n)
+	}
+}
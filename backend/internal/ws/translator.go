@@ -1,12 +1,115 @@
 package ws
 
-func translate(text, from, to string) string {
-	if from == "" {
-		from = "auto"
+import (
+	"context"
+	"log"
+	"time"
+
+	"realtime-chat/internal/config"
+	"realtime-chat/internal/langdetect"
+	"realtime-chat/internal/translate"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Translates reports whether text in from needs translating into to: not
+// when the languages match, nor when the hub runs with the "none" translator,
+// which would only hand the text back.
+func (h *Hub) Translates(from, to string) bool {
+	if to == "" || langdetect.Same(from, to) {
+		return false
+	}
+	_, noop := h.translator.(translate.Noop)
+	return !noop
+}
+
+// callTranslator translates text, retrying failed attempts with a growing
+// pause. Each attempt is bounded by TRANSLATE_TIMEOUT. It reports false, with
+// the original text, when nothing was translated.
+func (h *Hub) callTranslator(text, from, to string) (string, bool) {
+	if text == "" || to == "" || langdetect.Same(from, to) {
+		return text, false
+	}
+	timeout := config.C.TranslateTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	var err error
+	for attempt := 0; attempt <= config.C.TranslateRetries; attempt++ {
+		if attempt > 0 {
+			translationStats.Add("retries", 1)
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		var out string
+		out, err = h.translator.Translate(ctx, text, from, to)
+		cancel()
+		if err == nil {
+			return out, true
+		}
+	}
+	log.Printf("⚠️ translation %s->%s failed: %v", from, to, err)
+	return text, false
+}
+
+// translateMessage translates the text of message id into to. Each text is
+// translated at most once per language: results are kept in the node's LRU
+// and stored on the message under translations.<to>, where other nodes,
+// offline delivery and the history endpoints pick them up. It may block for
+// the translator's timeouts and retries, so delivery goes through localize.
+// A result identical to text is cached but not stored. stale reports that
+// the message was edited or deleted while translating, so the result must
+// not be shown.
+func (h *Hub) translateMessage(id, text, from, to string) (out string, ok, stale bool) {
+	if text == "" || !h.Translates(from, to) {
+		return text, false, false
 	}
-	if to == "" || from == to {
-		return text
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil || !langdetect.ValidCode(to) {
+		out, ok = h.callTranslator(text, from, to)
+		return out, ok, false
+	}
+
+	key := newTranslationKey(id, text, to)
+	if out, ok := h.translations.get(key); ok {
+		return out, true, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if out, ok := loadTranslation(ctx, oid, text, to); ok {
+		translationStats.Add("store_hits", 1)
+		h.translations.put(key, out)
+		return out, true, false
+	}
+
+	out, ok = h.callTranslator(text, from, to)
+	if !ok {
+		return out, false, false
+	}
+	h.translations.put(key, out)
+	if out == text {
+		// names, links and the like come back as sent
+		return out, true, false
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	current, err := saveTranslation(ctx, oid, text, to, out)
+	if err != nil {
+		log.Printf("⚠️ failed to store %s translation of message %s: %v", to, id, err)
+		return out, true, false
+	}
+	return out, true, !current
+}
+
+// localizeStored is localize for a message loaded from the database, using
+// a translation already stored on it when there is one.
+func (h *Hub) localizeStored(c *Client, out *OutgoingMessage, m *SavedMessage) {
+	if t, ok := m.Translations[c.preferredLang]; ok && !langdetect.Same(c.preferredLang, m.ContentLang) {
+		out.Text = t
+		return
 	}
-	// TODO: call real translation service
-	return "[translated " + from + "->" + to + "] " + text
+	h.localize(c, out, m.ContentLang)
 }
@@ -0,0 +1,122 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// typingTTL is how long a typing_start lasts without being refreshed. Clients
+// should resend typing_start while the user keeps typing; if they crash or
+// lose the connection the indicator clears itself.
+const typingTTL = 8 * time.Second
+
+// typingKey identifies one user's indicator in one conversation.
+type typingKey struct {
+	conversationID string
+	userID         string
+}
+
+// SetTyping relays a typing indicator to the other participants of a
+// conversation. Nothing is persisted; typing_start arms an expiry timer that
+// sends typing_stop on the user's behalf.
+func (h *Hub) SetTyping(userID, conversationID string, typing bool) error {
+	members, err := h.conversationMembers(conversationID)
+	if err != nil {
+		return err
+	}
+	if !contains(members, userID) {
+		return ErrNotGroupMember
+	}
+
+	key := typingKey{conversationID: conversationID, userID: userID}
+	h.typingMu.Lock()
+	t, wasTyping := h.typing[key]
+	if wasTyping {
+		t.Stop()
+		delete(h.typing, key)
+	}
+	if typing {
+		h.typing[key] = time.AfterFunc(typingTTL, func() {
+			h.expireTyping(key, members)
+		})
+	}
+	h.typingMu.Unlock()
+
+	// refreshes of an active indicator don't need another broadcast
+	if typing == wasTyping && typing {
+		return nil
+	}
+	h.publishTyping(userID, conversationID, members, typing)
+	return nil
+}
+
+// clearTyping stops every indicator the user has running on this node, e.g.
+// when their last local connection closes.
+func (h *Hub) clearTyping(userID string) {
+	var convs []string
+
+	h.typingMu.Lock()
+	for key, t := range h.typing {
+		if key.userID != userID {
+			continue
+		}
+		t.Stop()
+		delete(h.typing, key)
+		convs = append(convs, key.conversationID)
+	}
+	h.typingMu.Unlock()
+
+	for _, convID := range convs {
+		members, err := h.conversationMembers(convID)
+		if err != nil {
+			continue
+		}
+		h.publishTyping(userID, convID, members, false)
+	}
+}
+
+func (h *Hub) expireTyping(key typingKey, members []string) {
+	h.typingMu.Lock()
+	_, still := h.typing[key]
+	delete(h.typing, key)
+	h.typingMu.Unlock()
+	if still {
+		h.publishTyping(key.userID, key.conversationID, members, false)
+	}
+}
+
+func (h *Hub) publishTyping(userID, conversationID string, members []string, typing bool) {
+	others := make([]string, 0, len(members))
+	for _, m := range members {
+		if m != userID {
+			others = append(others, m)
+		}
+	}
+	ev := OutgoingMessage{
+		Type:           "typing_stop",
+		ConversationID: conversationID,
+		FromUser:       userID,
+	}
+	if typing {
+		ev.Type = "typing_start"
+	}
+	h.publish(kindDeliver, delivery{To: others, Message: ev})
+}
+
+// conversationMembers returns a conversation's members, preferring the
+// in-memory group table and falling back to the database (e.g. for DMs
+// created after the hub loaded).
+func (h *Hub) conversationMembers(conversationID string) ([]string, error) {
+	if members := h.groupMembers(conversationID); len(members) > 0 {
+		return members, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	conv, err := loadConversation(ctx, conversationID)
+	if err != nil {
+		log.Printf("⚠️ cannot load conversation %s: %v", conversationID, err)
+		return nil, ErrConversationNotFound
+	}
+	return conv.Members, nil
+}
@@ -32,12 +32,12 @@ const languages = [
 
 export function SettingsPage() {
   const navigate = useNavigate();
-  const { user, setUser } = useAuthStore();
+  const { user, setUser, updateProfile } = useAuthStore();
   const [theme, setTheme] = useState("system");
   const [displayName, setDisplayName] = useState(user?.name || "");
   const [language, setLanguage] = useState(user?.language || "en");
   const [messageDensity, setMessageDensity] = useState("comfortable");
-  const [readReceipts, setReadReceipts] = useState(true);
+  const [readReceipts, setReadReceipts] = useState(user?.readReceipts ?? true);
   const [allowDMs, setAllowDMs] = useState(true);
   const [isLoading, setIsLoading] = useState(false);
 
@@ -60,6 +60,17 @@ export function SettingsPage() {
     }
   };
 
+  const handleToggleReadReceipts = async (enabled) => {
+    setReadReceipts(enabled);
+    try {
+      // saves to /me and merges the setting into the stored user
+      await updateProfile({ readReceipts: enabled });
+    } catch (error) {
+      console.error("Failed to update read receipts:", error);
+      setReadReceipts(!enabled);
+    }
+  };
+
   const applyTheme = (newTheme) => {
     setTheme(newTheme);
 
@@ -268,7 +279,7 @@ export function SettingsPage() {
                 </div>
               </div>
               <button
-                onClick={() => setReadReceipts(!readReceipts)}
+                onClick={() => handleToggleReadReceipts(!readReceipts)}
                 className={cn(
                   "relative w-12 h-6 rounded-full transition-colors",
                   readReceipts
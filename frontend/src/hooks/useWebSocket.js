@@ -10,6 +10,8 @@ export function useWebSocket() {
   const { addMessage, addTypingUser, removeTypingUser, markAsRead, conversations } = useChatStore()
   const reconnectTimeoutRef = useRef(null)
   const reconnectAttemptsRef = useRef(0)
+  // Last event sequence number seen; sent as ?since= to resume after a drop
+  const lastSeqRef = useRef(0)
 
   const connect = () => {
     if (!isAuthenticated || !user || !token) return
@@ -24,7 +26,10 @@ export function useWebSocket() {
     // Use secure WebSocket (wss) when backend is https
     const proto = baseUrl.startsWith('https') ? 'wss' : 'ws'
     const host = baseUrl.replace('http://', '').replace('https://', '')
-    const wsUrl = `${proto}://${host}/ws?token=${token}&lang=en`
+    const since = lastSeqRef.current > 0 ? `&since=${lastSeqRef.current}` : ''
+    // without lang the server uses the profile language
+    const lang = user.language ? `&lang=${encodeURIComponent(user.language)}` : ''
+    const wsUrl = `${proto}://${host}/ws?token=${token}${lang}${since}`
     
     try {
       setConnectionStatus('connecting')
@@ -41,6 +46,9 @@ export function useWebSocket() {
       ws.onmessage = (event) => {
         try {
           const message = JSON.parse(event.data)
+          if (message.seq && message.seq > lastSeqRef.current) {
+            lastSeqRef.current = message.seq
+          }
           handleIncomingMessage(message)
         } catch (error) {
           console.error('Failed to parse WebSocket message:', error)
@@ -90,13 +98,15 @@ export function useWebSocket() {
       case 'message':
         // Handle incoming chat message
         const chatMessage = {
-          id: Date.now().toString() + Math.random(),
+          id: message.id || Date.now().toString() + Math.random(),
           content: message.text,
           senderId: message.from_user,
           senderName: message.sender_name || message.sender_display_name || message.from_user,
           timestamp: message.created_at || new Date().toISOString(),
           type: (message.files && message.files.some(f => /\.(mp3|wav|webm|ogg|m4a)$/i.test(f))) ? 'voice' : 'text',
-          files: message.files || []
+          files: message.files || [],
+          editedAt: message.edited_at,
+          translationPending: !!message.translation_pending
         }
         // Attach reply metadata if present
         if (message.reply_to) {
@@ -122,6 +132,7 @@ export function useWebSocket() {
         } else if (message.chat_type === 'group') {
           conversationId = message.group_id
         }
+        conversationId = conversationId || message.conversation_id
         
         if (conversationId) {
           console.debug('Adding message to conversation:', conversationId)
@@ -131,6 +142,83 @@ export function useWebSocket() {
         }
         break
         
+      case 'message_ack':
+        // Server persisted our message: swap the optimistic id for the real one
+        if (message.nonce && message.conversation_id) {
+          useChatStore.getState().updateMessage(message.conversation_id, message.nonce, {
+            id: message.id,
+            timestamp: message.created_at,
+            status: 'sent'
+          })
+        }
+        break
+
+      case 'message_edited':
+        if (message.conversation_id && message.id) {
+          useChatStore.getState().updateMessage(message.conversation_id, message.id, {
+            content: message.text,
+            editedAt: message.edited_at
+          })
+        }
+        break
+
+      case 'message_translated': {
+        // the translation of a message delivered with translation_pending
+        if (!message.conversation_id || !message.id) break
+        // ignore translations of a revision the message no longer shows
+        const current = useChatStore.getState().messages[message.conversation_id]
+          ?.find(m => m.id === message.id)
+        const revision = (t) => (t ? new Date(t).getTime() : 0)
+        if (current && revision(current.editedAt) !== revision(message.edited_at)) break
+        useChatStore.getState().updateMessage(message.conversation_id, message.id, {
+          ...(message.translation_failed ? {} : { content: message.text }),
+          translationPending: false
+        })
+        break
+      }
+
+      case 'message_deleted':
+        if (message.conversation_id && message.id) {
+          if (message.scope === 'me') {
+            const list = useChatStore.getState().messages[message.conversation_id] || []
+            useChatStore.getState().setMessages(message.conversation_id, list.filter(m => m.id !== message.id))
+          } else {
+            useChatStore.getState().updateMessage(message.conversation_id, message.id, {
+              content: '',
+              files: [],
+              deleted: true
+            })
+          }
+        }
+        break
+
+      case 'reaction_updated':
+        if (message.conversation_id && message.id) {
+          useChatStore.getState().updateMessage(message.conversation_id, message.id, {
+            reactions: message.reactions || []
+          })
+        }
+        break
+
+      case 'typing_start': {
+        const typing = useChatStore.getState().typingUsers[message.conversation_id] || []
+        if (!typing.includes(message.from_user)) {
+          addTypingUser(message.conversation_id, message.from_user)
+        }
+        break
+      }
+
+      case 'typing_stop':
+        removeTypingUser(message.conversation_id, message.from_user)
+        break
+
+      case 'read_receipt':
+        // from_user has read everything up to message.id
+        if (message.conversation_id && message.id) {
+          markAsRead(message.conversation_id, message.id, message.from_user)
+        }
+        break
+
       case 'group_created':
         // Handle group creation notification
           console.debug('Group created:', message)
@@ -149,6 +237,20 @@ export function useWebSocket() {
         console.debug('Joined group:', message)
         break
         
+      case 'sync_complete':
+        console.debug('WebSocket session resumed at seq', message.seq)
+        break
+
+      case 'resync_required':
+        // Missed events expired on the server; reload conversations instead
+        try {
+          const updatedConversations = await apiService.getConversations()
+          useChatStore.getState().setConversations(updatedConversations)
+        } catch (error) {
+          console.error('❌ Failed to resync conversations:', error)
+        }
+        break
+
       case 'error':
         console.error('WebSocket error message:', message.error)
         break
@@ -204,6 +306,9 @@ export function useWebSocket() {
       return false
     }
 
+    // Optimistic id doubles as the nonce echoed back in message_ack
+    const nonce = Date.now().toString() + Math.random()
+
     // Prepare WebSocket message based on conversation type
     let wsMessage
     if (conversation.type === 'dm') {
@@ -223,8 +328,8 @@ export function useWebSocket() {
         chat_type: 'dm',
         to_user: otherUserId, // Use the actual other user's ID, not conversation ID
         conversation_id: conversationId, // Add conversation ID for consistency
-        text: message.text,
-        source_lang: 'en'
+        text: message.text, // the server detects the language
+        nonce
       }
       if (message.replyTo) {
         wsMessage.reply_to = message.replyTo
@@ -241,7 +346,7 @@ export function useWebSocket() {
         group_id: conversationId,
         conversation_id: conversationId, // Add for consistency
         text: message.text,
-        source_lang: 'en'
+        nonce
       }
       if (message.replyTo) {
         wsMessage.reply_to = message.replyTo
@@ -259,7 +364,7 @@ export function useWebSocket() {
     // Add message optimistically to UI
     const messageWithId = {
       ...message,
-      id: Date.now().toString() + Math.random(),
+      id: nonce,
       senderId: user.id,
       senderName: user.displayName,
       timestamp: new Date().toISOString(),
@@ -282,8 +387,16 @@ export function useWebSocket() {
   const sendTypingIndicator = (conversationId, isTyping) => {
     if (connectionStatus !== 'connected' || !wsRef.current) return
 
-    // TODO: Implement typing indicators in backend
-    console.debug(`Typing indicator: ${isTyping ? 'start' : 'stop'} typing in ${conversationId}`)
+    // Server relays to the other participants and expires stale indicators,
+    // so keep resending typing_start while the user is still typing
+    try {
+      wsRef.current.send(JSON.stringify({
+        type: isTyping ? 'typing_start' : 'typing_stop',
+        conversation_id: conversationId
+      }))
+    } catch (error) {
+      console.error('Failed to send typing indicator:', error)
+    }
   }
 
   const createGroup = (name, members) => {
@@ -160,53 +160,61 @@ class APIService {
   }
 
   // Message history methods
-  async getDMHistory(otherUserId, limit = 50, offset = 0) {
+  // History endpoints return { messages (oldest first), has_more }.
+  // Pass { before } (message id or timestamp) to load older messages,
+  // { after } for newer ones, or { around } to jump to a message.
+  async getDMHistory(otherUserId, limit = 50, cursor = {}) {
     try {
-      const rawMessages = await this.get('/messages/dm', {
+      const page = await this.get('/messages/dm', {
         user_id: otherUserId,
         limit,
-        offset
+        ...cursor
       })
-      // Handle null or undefined response
-      if (!rawMessages || !Array.isArray(rawMessages)) {
-        console.warn('API returned invalid DM messages data:', rawMessages)
-        return []
-      }
-      // Transform API response to frontend format and reverse to chronological order
-      const transformedMessages = rawMessages
-        .filter(msg => msg && typeof msg === 'object') // Filter out null/invalid messages
-        .map(msg => ({
-          id: msg._id,
-          senderId: msg.sender_id,
-          // prefer server-provided sender_name or display_name when available
-          senderName: msg.sender_name || msg.sender_display_name || msg.sender_id,
-          content: msg.content,
-          timestamp: new Date(msg.created_at),
-          type: (msg.files && msg.files.some(f => /\.(mp3|wav|webm|ogg|m4a)$/i.test(f))) ? 'voice' : 'text',
-          isRead: false,
-          files: msg.files || [],
-          contentLang: msg.content_lang,
-          // reply metadata (server may return resolved display names)
-          replyTo: msg.reply_to || null,
-          replyText: msg.reply_text || null,
-          replySender: msg.reply_sender || null,
-        }))
-      // Reverse to show oldest first
-      return transformedMessages.reverse()
+      return this.transformHistory(page)
     } catch (error) {
       console.warn('API DM messages not available:', error)
       return []
     }
   }
 
-  async getGroupHistory(groupId, limit = 50, offset = 0) {
+  async getGroupHistory(groupId, limit = 50, cursor = {}) {
     return this.get('/messages/group', {
       group_id: groupId,
       limit,
-      offset
+      ...cursor
     })
   }
 
+  // Transform a history page to frontend messages (already oldest first)
+  transformHistory(page) {
+    // Handle null or invalid response
+    if (!page || !Array.isArray(page.messages)) {
+      console.warn('API returned invalid history page:', page)
+      return []
+    }
+    return page.messages
+      .filter(msg => msg && typeof msg === 'object') // Filter out null/invalid messages
+      .map(msg => ({
+        id: msg.id,
+        senderId: msg.sender_id,
+        // prefer server-provided sender_name or display_name when available
+        senderName: msg.sender_name || msg.sender_display_name || msg.sender_id,
+        // history comes translated into the user's language
+        content: msg.translated || msg.content,
+        originalContent: msg.original || msg.content,
+        timestamp: new Date(msg.created_at),
+        type: (msg.files && msg.files.some(f => /\.(mp3|wav|webm|ogg|m4a)$/i.test(f))) ? 'voice' : 'text',
+        isRead: false,
+        files: msg.files || [],
+        contentLang: msg.content_lang,
+        editedAt: msg.edited_at,
+        // reply metadata (server may return resolved display names)
+        replyTo: msg.reply_to || null,
+        replyText: msg.reply_text || null,
+        replySender: msg.reply_sender || null,
+      }))
+  }
+
   // Presence methods
   async getPresence() {
     return this.get('/presence')
@@ -230,33 +238,14 @@ class APIService {
   }
 
   // Get messages for a conversation
-  async getMessages(conversationId) {
+  async getMessages(conversationId, cursor = {}) {
     try {
-      const rawMessages = await this.get(`/messages/group?group_id=${conversationId}&limit=100`)
-      // Handle null or undefined response
-      if (!rawMessages || !Array.isArray(rawMessages)) {
-        console.warn('API returned invalid messages data:', rawMessages)
-        return []
-      }
-      // Transform API response to frontend format and reverse to chronological order
-      const transformedMessages = rawMessages
-        .filter(msg => msg && typeof msg === 'object') // Filter out null/invalid messages
-        .map(msg => ({
-          id: msg._id,
-          senderId: msg.sender_id,
-          senderName: msg.sender_name || msg.sender_display_name || msg.sender_id,
-          content: msg.content,
-          timestamp: new Date(msg.created_at),
-          type: (msg.files && msg.files.some(f => /\.(mp3|wav|webm|ogg|m4a)$/i.test(f))) ? 'voice' : 'text',
-          isRead: false,
-          files: msg.files || [],
-          contentLang: msg.content_lang,
-          replyTo: msg.reply_to || null,
-          replyText: msg.reply_text || null,
-          replySender: msg.reply_sender || null,
-        }))
-      // Reverse to show oldest first
-      return transformedMessages.reverse()
+      const page = await this.get('/messages/group', {
+        group_id: conversationId,
+        limit: 100,
+        ...cursor
+      })
+      return this.transformHistory(page)
     } catch (error) {
       console.warn('API messages not available:', error)
       return []
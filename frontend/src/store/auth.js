@@ -40,7 +40,8 @@ export const useAuthStore = create(
             displayName: userDetails.display_name,
             language: userDetails.language,
             locale: userDetails.locale,
-            isVerified: userDetails.is_verified
+            isVerified: userDetails.is_verified,
+            readReceipts: userDetails.read_receipts
           }
           
           console.debug('Setting user in store:', user)
@@ -113,7 +114,9 @@ export const useAuthStore = create(
             id: response.user_id,
             email: userDetails?.email || email, // Use provided email as fallback
             name: userDetails?.name || displayName,
-            isVerified: true
+            language: userDetails?.language,
+            isVerified: true,
+            readReceipts: userDetails?.read_receipts
           }
           
           // Store tokens and additional data for fallback